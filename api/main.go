@@ -22,6 +22,7 @@ type WebAPI struct {
 	Cron           *cron.Cron
 	AssignLimiters sync.Map
 	SubmitLimiters sync.Map
+	RecipeSchemas  sync.Map
 }
 
 type RequestHandler func(*Request)
@@ -52,6 +53,20 @@ func (api *WebAPI) setupMonitoring() {
 
 	timeoutSchedule := cron.Every(config.Cfg.ResetTimedOutTasksInterval)
 	api.Cron.Schedule(timeoutSchedule, cron.FuncJob(api.Database.ResetTimedOutTasks))
+
+	purgeSchedule := cron.Every(config.Cfg.PurgeCompletedHashesInterval)
+	api.Cron.Schedule(purgeSchedule, cron.FuncJob(api.Database.PurgeCompletedHashes))
+
+	// Also creates the upcoming partitions of the archive, so it runs once right away
+	api.Database.PurgeTaskArchive()
+	archiveSchedule := cron.Every(config.Cfg.PurgeTaskArchiveInterval)
+	api.Cron.Schedule(archiveSchedule, cron.FuncJob(api.Database.PurgeTaskArchive))
+
+	completedSchedule := cron.Every(config.Cfg.PurgeCompletedTasksInterval)
+	api.Cron.Schedule(completedSchedule, cron.FuncJob(api.Database.PurgeCompletedTasks))
+
+	groupsSchedule := cron.Every(config.Cfg.PurgeTaskGroupsInterval)
+	api.Cron.Schedule(groupsSchedule, cron.FuncJob(api.Database.PurgeTaskGroups))
 	api.Cron.Start()
 
 	logrus.WithFields(logrus.Fields{
@@ -60,6 +75,20 @@ func (api *WebAPI) setupMonitoring() {
 	logrus.WithFields(logrus.Fields{
 		"every": config.Cfg.ResetTimedOutTasksInterval.String(),
 	}).Info("Started task cleanup cron")
+	logrus.WithFields(logrus.Fields{
+		"every": config.Cfg.PurgeCompletedHashesInterval.String(),
+	}).Info("Started completed hashes cleanup cron")
+	logrus.WithFields(logrus.Fields{
+		"every":     config.Cfg.PurgeTaskArchiveInterval.String(),
+		"retention": config.Cfg.ArchiveRetention.String(),
+	}).Info("Started task archive cleanup cron")
+	logrus.WithFields(logrus.Fields{
+		"every":     config.Cfg.PurgeCompletedTasksInterval.String(),
+		"retention": config.Cfg.CompletedTaskRetention.String(),
+	}).Info("Started completed tasks cleanup cron")
+	logrus.WithFields(logrus.Fields{
+		"every": config.Cfg.PurgeTaskGroupsInterval.String(),
+	}).Info("Started task groups cleanup cron")
 }
 
 func New() *WebAPI {
@@ -94,6 +123,7 @@ func New() *WebAPI {
 	api.router.POST("/worker/create", Middleware(api.CreateWorker))
 	api.router.POST("/worker/update", Middleware(api.UpdateWorker))
 	api.router.POST("/worker/set_paused", Middleware(api.WorkerSetPaused))
+	api.router.POST("/worker/set_max_concurrent_tasks", Middleware(api.WorkerSetMaxConcurrentTasks))
 	api.router.GET("/worker/get/:id", Middleware(api.GetWorker))
 	api.router.GET("/worker/stats", Middleware(api.GetAllWorkerStats))
 
@@ -112,14 +142,38 @@ func New() *WebAPI {
 	api.router.POST("/project/secret/:id", Middleware(api.SetSecret))
 	api.router.GET("/project/webhook_secret/:id", Middleware(api.GetWebhookSecret))
 	api.router.POST("/project/webhook_secret/:id", Middleware(api.SetWebhookSecret))
+	api.router.POST("/project/tasks/:id", Middleware(api.GetTasks))
+	api.router.GET("/project/task/:id/:task", Middleware(api.GetTaskDetails))
+	api.router.POST("/project/delete_task/:id/:task", Middleware(api.DeleteTasks))
+	api.router.POST("/project/delete_tasks/:id", Middleware(api.DeleteTasks))
+	api.router.POST("/project/update_task/:id/:task", Middleware(api.UpdateTasks))
+	api.router.POST("/project/update_tasks/:id", Middleware(api.UpdateTasks))
+	api.router.POST("/project/unassign_task/:id/:task", Middleware(api.UnassignTasks))
+	api.router.POST("/project/unassign_tasks/:id", Middleware(api.UnassignTasks))
+	api.router.POST("/project/cancel_task/:id/:task", Middleware(api.CancelTasks))
+	api.router.POST("/project/cancel_tasks/:id", Middleware(api.CancelTasks))
+	api.router.POST("/project/requeue_task/:id/:task", Middleware(api.RequeueDisputedTasks))
+	api.router.POST("/project/requeue_tasks/:id", Middleware(api.RequeueDisputedTasks))
+	api.router.POST("/project/move_task/:id/:task", Middleware(api.MoveTasks))
+	api.router.POST("/project/move_tasks/:id", Middleware(api.MoveTasks))
+	api.router.GET("/project/failed_tasks/:id", Middleware(api.GetFailedTasks))
+	api.router.GET("/project/archived_tasks/:id", Middleware(api.GetArchivedTasks))
+	api.router.GET("/project/results/:id", Middleware(api.GetResults))
+	api.router.GET("/project/export_results/:id", Middleware(api.ExportResults))
 	api.router.POST("/project/reset_failed_tasks/:id", Middleware(api.ResetFailedTasks))
 	api.router.POST("/project/hard_reset/:id", Middleware(api.HardReset))
 	api.router.POST("/project/reclaim_assigned_tasks/:id", Middleware(api.ReclaimAssignedTasks))
 
 	api.router.POST("/task/submit", Middleware(api.SubmitTask))
 	api.router.POST("/task/bulk_submit", Middleware(api.BulkSubmitTask))
+	api.router.GET("/task/get", Middleware(api.GetTask))
 	api.router.GET("/task/get/:project", Middleware(api.GetTaskFromProject))
+	api.router.GET("/task/bulk_get/:project", Middleware(api.GetTasksFromProject))
 	api.router.POST("/task/release", Middleware(api.ReleaseTask))
+	api.router.POST("/task/bulk_release", Middleware(api.BulkReleaseTask))
+	api.router.POST("/task/heartbeat", Middleware(api.TaskHeartbeat))
+	api.router.POST("/task/bulk_heartbeat", Middleware(api.BulkTaskHeartbeat))
+	api.router.POST("/task/progress", Middleware(api.SetTaskProgress))
 
 	api.router.POST("/git/receivehook", Middleware(api.ReceiveGitWebHook))
 
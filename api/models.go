@@ -7,9 +7,27 @@ import (
 )
 
 const (
-	MinPasswordLength = 8
-	MinUsernameLength = 3
-	MaxUsernameLength = 16
+	MinPasswordLength     = 8
+	MinUsernameLength     = 3
+	MaxUsernameLength     = 16
+	MaxBulkGetCount       = 1000
+	MaxBulkReleaseCount   = 1000
+	MaxBulkHeartbeatCount = 1000
+	MaxWait               = 60
+
+	MaxReleaseMessageLength = 4096
+	MaxCheckpointLength     = 4096
+	MaxReleaseDetailsLength = 4096
+	MaxReleaseOutputLength  = 4096
+	MaxDependencies         = 64
+	MaxChains               = 16
+	MaxReleaseChildren      = 1000
+	MaxGroupLength          = 255
+	MaxTags                 = 32
+	MaxTagLength            = 64
+
+	MinRetryMultiplier = 1
+	MaxRetryMultiplier = 10
 )
 
 type JsonResponse struct {
@@ -128,21 +146,72 @@ type CreateProjectRequest struct {
 	Chain      int64      `json:"chain"`
 	AssignRate rate.Limit `json:"assign_rate"`
 	SubmitRate rate.Limit `json:"submit_rate"`
+
+	RetryDelay      int64   `json:"retry_delay"`
+	RetryMultiplier float64 `json:"retry_multiplier"`
+	RetryMaxDelay   int64   `json:"retry_max_delay"`
+
+	Chains              []storage.ProjectChain `json:"chains"`
+	AssignStrategy      storage.AssignStrategy `json:"assign_strategy"`
+	MaxInFlightPerGroup int64                  `json:"max_in_flight_per_group"`
+
+	DefaultMaxConcurrentTasks int64 `json:"default_max_concurrent_tasks"`
+
+	DedupMode               storage.DedupMode `json:"dedup_mode"`
+	DedupTtl                int64             `json:"dedup_ttl"`
+	MaxVerificationAttempts int64             `json:"max_verification_attempts"`
+
+	MinReputation            float64 `json:"min_reputation"`
+	TrustedReputation        float64 `json:"trusted_reputation"`
+	TrustedVerificationCount int16   `json:"trusted_verification_count"`
+
+	KeepCompletedTasks bool `json:"keep_completed_tasks"`
+	ArchiveTasks       bool `json:"archive_tasks"`
+
+	RecipeSchema string `json:"recipe_schema"`
 }
 
 func (req *CreateProjectRequest) isValid() bool {
 	if len(req.Name) <= 0 {
 		return false
 	}
+	if !isRetryPolicyValid(req.RetryDelay, req.RetryMultiplier, req.RetryMaxDelay) {
+		return false
+	}
 	if req.Priority < 0 {
 		return false
 	}
 	if req.Hidden && req.Public {
 		return false
 	}
+	if !isChainListValid(0, req.Chain, req.Chains) {
+		return false
+	}
+	if !isAssignStrategyValid(req.AssignStrategy) {
+		return false
+	}
+	if req.MaxInFlightPerGroup < 0 {
+		return false
+	}
+	if req.DefaultMaxConcurrentTasks < 0 {
+		return false
+	}
+	if !isDedupPolicyValid(req.DedupMode, req.DedupTtl) {
+		return false
+	}
+	if req.MaxVerificationAttempts < 0 {
+		return false
+	}
+	if !isReputationPolicyValid(req.MinReputation, req.TrustedReputation, req.TrustedVerificationCount) {
+		return false
+	}
+	if !isRecipeSchemaValid(req.RecipeSchema) {
+		return false
+	}
 	return true
 }
 
+// The settings that are pointers (and chains) are left unchanged if omitted
 type UpdateProjectRequest struct {
 	Name       string     `json:"name"`
 	CloneUrl   string     `json:"clone_url"`
@@ -156,12 +225,91 @@ type UpdateProjectRequest struct {
 	AssignRate rate.Limit `json:"assign_rate"`
 	SubmitRate rate.Limit `json:"submit_rate"`
 	Version    string     `json:"version"`
+
+	RetryDelay      *int64   `json:"retry_delay"`
+	RetryMultiplier *float64 `json:"retry_multiplier"`
+	RetryMaxDelay   *int64   `json:"retry_max_delay"`
+
+	Chains              []storage.ProjectChain  `json:"chains"`
+	AssignStrategy      *storage.AssignStrategy `json:"assign_strategy"`
+	MaxInFlightPerGroup *int64                  `json:"max_in_flight_per_group"`
+
+	DefaultMaxConcurrentTasks *int64 `json:"default_max_concurrent_tasks"`
+
+	DedupMode               *storage.DedupMode `json:"dedup_mode"`
+	DedupTtl                *int64             `json:"dedup_ttl"`
+	MaxVerificationAttempts *int64             `json:"max_verification_attempts"`
+
+	MinReputation            *float64 `json:"min_reputation"`
+	TrustedReputation        *float64 `json:"trusted_reputation"`
+	TrustedVerificationCount *int16   `json:"trusted_verification_count"`
+
+	KeepCompletedTasks *bool `json:"keep_completed_tasks"`
+	ArchiveTasks       *bool `json:"archive_tasks"`
+
+	RecipeSchema *string `json:"recipe_schema"`
 }
 
+// Sets the omitted settings to their current value
+func (req *UpdateProjectRequest) keepUnchanged(project *storage.Project) {
+	if req.RetryDelay == nil {
+		req.RetryDelay = &project.RetryDelay
+	}
+	if req.RetryMultiplier == nil {
+		req.RetryMultiplier = &project.RetryMultiplier
+	}
+	if req.RetryMaxDelay == nil {
+		req.RetryMaxDelay = &project.RetryMaxDelay
+	}
+	if req.Chains == nil {
+		req.Chains = project.Chains
+	}
+	if req.AssignStrategy == nil {
+		req.AssignStrategy = &project.AssignStrategy
+	}
+	if req.MaxInFlightPerGroup == nil {
+		req.MaxInFlightPerGroup = &project.MaxInFlightPerGroup
+	}
+	if req.DefaultMaxConcurrentTasks == nil {
+		req.DefaultMaxConcurrentTasks = &project.DefaultMaxConcurrentTasks
+	}
+	if req.DedupMode == nil {
+		req.DedupMode = &project.DedupMode
+	}
+	if req.DedupTtl == nil {
+		req.DedupTtl = &project.DedupTtl
+	}
+	if req.MaxVerificationAttempts == nil {
+		req.MaxVerificationAttempts = &project.MaxVerificationAttempts
+	}
+	if req.MinReputation == nil {
+		req.MinReputation = &project.MinReputation
+	}
+	if req.TrustedReputation == nil {
+		req.TrustedReputation = &project.TrustedReputation
+	}
+	if req.TrustedVerificationCount == nil {
+		req.TrustedVerificationCount = &project.TrustedVerificationCount
+	}
+	if req.KeepCompletedTasks == nil {
+		req.KeepCompletedTasks = &project.KeepCompletedTasks
+	}
+	if req.ArchiveTasks == nil {
+		req.ArchiveTasks = &project.ArchiveTasks
+	}
+	if req.RecipeSchema == nil {
+		req.RecipeSchema = &project.RecipeSchema
+	}
+}
+
+// Must be called after keepUnchanged
 func (req *UpdateProjectRequest) isValid(pid int64) bool {
 	if len(req.Name) <= 0 {
 		return false
 	}
+	if !isRetryPolicyValid(*req.RetryDelay, *req.RetryMultiplier, *req.RetryMaxDelay) {
+		return false
+	}
 	if req.Priority < 0 {
 		return false
 	}
@@ -171,6 +319,86 @@ func (req *UpdateProjectRequest) isValid(pid int64) bool {
 	if req.Chain == pid {
 		return false
 	}
+	if !isChainListValid(pid, req.Chain, req.Chains) {
+		return false
+	}
+	if !isAssignStrategyValid(*req.AssignStrategy) {
+		return false
+	}
+	if *req.MaxInFlightPerGroup < 0 {
+		return false
+	}
+	if *req.DefaultMaxConcurrentTasks < 0 {
+		return false
+	}
+	if !isDedupPolicyValid(*req.DedupMode, *req.DedupTtl) {
+		return false
+	}
+	if *req.MaxVerificationAttempts < 0 {
+		return false
+	}
+	if !isReputationPolicyValid(*req.MinReputation, *req.TrustedReputation, *req.TrustedVerificationCount) {
+		return false
+	}
+	if !isRecipeSchemaValid(*req.RecipeSchema) {
+		return false
+	}
+	return true
+}
+
+func isDedupPolicyValid(mode storage.DedupMode, ttl int64) bool {
+	if mode == storage.DEDUP_TTL {
+		return ttl > 0
+	}
+	return (mode == storage.DEDUP_NONE || mode == storage.DEDUP_FOREVER) && ttl >= 0
+}
+
+func isRecipeSchemaValid(schema string) bool {
+	_, err := compileRecipeSchema(schema)
+	return err == nil
+}
+
+func isReputationPolicyValid(minReputation float64, trustedReputation float64, trustedCount int16) bool {
+	return minReputation >= 0 && minReputation <= 1 &&
+		trustedReputation >= 0 && trustedReputation <= 1 &&
+		trustedCount >= 0
+}
+
+func isAssignStrategyValid(strategy storage.AssignStrategy) bool {
+	return strategy >= storage.ASSIGN_PRIORITY && strategy <= storage.ASSIGN_FAIR
+}
+
+// The legacy chain can't also be a target of chains, the task would be copied twice
+func isChainListValid(pid int64, chain int64, chains []storage.ProjectChain) bool {
+	if len(chains) > MaxChains {
+		return false
+	}
+	targets := make(map[int64]bool)
+	if chain != 0 {
+		targets[chain] = true
+	}
+	for _, chain := range chains {
+		if chain.Target <= 0 || chain.Target == pid || targets[chain.Target] {
+			return false
+		}
+		if len(chain.Fields) != 0 && len(chain.Template) != 0 {
+			return false
+		}
+		targets[chain.Target] = true
+	}
+	return true
+}
+
+func isRetryPolicyValid(delay int64, multiplier float64, maxDelay int64) bool {
+	if delay < 0 || maxDelay < 0 {
+		return false
+	}
+	if multiplier < MinRetryMultiplier || multiplier > MaxRetryMultiplier {
+		return false
+	}
+	if delay > 0 && maxDelay < delay {
+		return false
+	}
 	return true
 }
 
@@ -203,12 +431,47 @@ type SubmitTaskRequest struct {
 	Hash64            int64  `json:"hash_u64"`
 	UniqueString      string `json:"unique_string"`
 	VerificationCount int16  `json:"verification_count"`
+	NotBefore         int64  `json:"not_before"`
+	Group             string `json:"group"`
+
+	Dependencies []TaskDependencyRequest `json:"dependencies"`
+	RequiredTags []string                `json:"required_tags"`
+}
+
+// Parent is either TaskId, or UniqueString in Project (defaults
+// to the project of the submitted task)
+type TaskDependencyRequest struct {
+	TaskId         int64  `json:"task_id"`
+	Project        int64  `json:"project"`
+	UniqueString   string `json:"unique_string"`
+	CascadeFailure bool   `json:"cascade_failure"`
+}
+
+func (req *TaskDependencyRequest) IsValid() bool {
+	return (req.TaskId > 0) != (len(req.UniqueString) != 0) && req.Project >= 0
 }
 
 func (req *SubmitTaskRequest) IsValid() bool {
 	if req.MaxRetries < 0 {
 		return false
 	}
+	if len(req.Dependencies) > MaxDependencies {
+		return false
+	}
+	if len(req.Group) > MaxGroupLength {
+		return false
+	}
+	if !isTagListValid(req.RequiredTags) {
+		return false
+	}
+	for i := range req.Dependencies {
+		if !req.Dependencies[i].IsValid() {
+			return false
+		}
+	}
+	if req.NotBefore < 0 {
+		return false
+	}
 	if len(req.Recipe) <= 0 {
 		return false
 	}
@@ -222,40 +485,140 @@ func (req *SubmitTaskRequest) IsValid() bool {
 	return true
 }
 
+type SubmitTaskResponse struct {
+	Id int64 `json:"id"`
+}
+
 type BulkSubmitTaskRequest struct {
 	Requests []SubmitTaskRequest `json:"requests"`
 }
 
+// The requests themselves are validated one by one, invalid
+// requests are reported in the results of the bulk submit
 func (reqs BulkSubmitTaskRequest) IsValid() bool {
 
 	if reqs.Requests == nil {
 		return false
 	}
 
-	if len(reqs.Requests) == 0 {
+	return len(reqs.Requests) != 0
+}
+
+type ReleaseTaskRequest struct {
+	TaskId       int64               `json:"task_id"`
+	Result       storage.TaskResult  `json:"result"`
+	Verification int64               `json:"verification"`
+	Message      string              `json:"message"`
+	Details      json.RawMessage     `json:"details"`
+	Output       json.RawMessage     `json:"output"`
+	Children     []SubmitTaskRequest `json:"children"`
+}
+
+func (r *ReleaseTaskRequest) IsValid() bool {
+	if r.TaskId == 0 || len(r.Message) > MaxReleaseMessageLength {
 		return false
 	}
-
-	for _, req := range reqs.Requests {
-		if !req.IsValid() {
+	if len(r.Details) > MaxReleaseDetailsLength || len(r.Output) > MaxReleaseOutputLength {
+		return false
+	}
+	if len(r.Children) > MaxReleaseChildren {
+		return false
+	}
+	if len(r.Children) != 0 && r.Result != storage.TR_OK {
+		return false
+	}
+	for i := range r.Children {
+		if !r.Children[i].IsValid() {
 			return false
 		}
 	}
 	return true
 }
 
-type ReleaseTaskRequest struct {
-	TaskId       int64              `json:"task_id"`
-	Result       storage.TaskResult `json:"result"`
-	Verification int64              `json:"verification"`
+func (r *ReleaseTaskRequest) toStorage(workerId int64) storage.ReleaseRequest {
+
+	children := make([]storage.SaveTaskRequest, len(r.Children))
+	for i := range r.Children {
+		children[i] = makeSaveTaskRequest(&r.Children[i], workerId)
+	}
+
+	return storage.ReleaseRequest{
+		TaskId:       r.TaskId,
+		Result:       r.Result,
+		Verification: r.Verification,
+		Message:      r.Message,
+		Details:      string(r.Details),
+		Output:       string(r.Output),
+		Children:     children,
+	}
 }
 
-func (r *ReleaseTaskRequest) IsValid() bool {
+// Children has the result of each child, only set if the release closed the task
+type ReleaseTaskResponse struct {
+	Updated  bool                   `json:"updated"`
+	Children []BulkSubmitTaskResult `json:"children,omitempty"`
+}
+
+type BulkReleaseTaskRequest struct {
+	Requests []ReleaseTaskRequest `json:"requests"`
+}
+
+func (reqs *BulkReleaseTaskRequest) IsValid() bool {
+	return len(reqs.Requests) != 0 && len(reqs.Requests) <= MaxBulkReleaseCount
+}
+
+type BulkReleaseTaskResult struct {
+	TaskId   int64                  `json:"task_id"`
+	Updated  bool                   `json:"updated"`
+	Message  string                 `json:"message,omitempty"`
+	Children []BulkSubmitTaskResult `json:"children,omitempty"`
+}
+
+type BulkReleaseTaskResponse struct {
+	Results []BulkReleaseTaskResult `json:"results"`
+}
+
+type TaskHeartbeatRequest struct {
+	TaskId int64 `json:"task_id"`
+}
+
+func (r *TaskHeartbeatRequest) IsValid() bool {
 	return r.TaskId != 0
 }
 
-type ReleaseTaskResponse struct {
-	Updated bool `json:"updated"`
+type TaskHeartbeatResponse struct {
+	LeaseRemaining int64 `json:"lease_remaining"`
+}
+
+type BulkTaskHeartbeatRequest struct {
+	TaskIds []int64 `json:"task_ids"`
+}
+
+func (r *BulkTaskHeartbeatRequest) IsValid() bool {
+	return len(r.TaskIds) != 0 && len(r.TaskIds) <= MaxBulkHeartbeatCount
+}
+
+type BulkTaskHeartbeatResponse struct {
+	Leases []storage.TaskLease `json:"leases"`
+}
+
+type TaskProgressRequest struct {
+	TaskId     int64   `json:"task_id"`
+	Progress   float32 `json:"progress"`
+	Checkpoint string  `json:"checkpoint"`
+}
+
+func (r *TaskProgressRequest) IsValid() bool {
+	if r.TaskId == 0 {
+		return false
+	}
+	if r.Progress < 0 || r.Progress > 100 {
+		return false
+	}
+	if len(r.Checkpoint) > MaxCheckpointLength {
+		return false
+	}
+	return true
 }
 
 type CreateTaskResponse struct {
@@ -265,8 +628,18 @@ type GetTaskResponse struct {
 	Task *storage.Task `json:"task,omitempty"`
 }
 
+type GetTasksResponse struct {
+	Tasks []storage.Task `json:"tasks"`
+}
+
+// Tags are left unchanged if omitted
 type UpdateWorkerRequest struct {
-	Alias string `json:"alias"`
+	Alias string   `json:"alias"`
+	Tags  []string `json:"tags"`
+}
+
+func (req *UpdateWorkerRequest) isValid() bool {
+	return isTagListValid(req.Tags)
 }
 
 type WorkerSetPausedRequest struct {
@@ -274,8 +647,18 @@ type WorkerSetPausedRequest struct {
 	Paused bool  `json:"paused"`
 }
 
+type WorkerSetMaxConcurrentTasksRequest struct {
+	Worker             int64 `json:"worker"`
+	MaxConcurrentTasks int64 `json:"max_concurrent_tasks"`
+}
+
+func (req *WorkerSetMaxConcurrentTasksRequest) isValid() bool {
+	return req.MaxConcurrentTasks >= 0
+}
+
 type CreateWorkerRequest struct {
-	Alias string `json:"alias"`
+	Alias string   `json:"alias"`
+	Tags  []string `json:"tags"`
 }
 
 func (req *CreateWorkerRequest) isValid() bool {
@@ -283,10 +666,25 @@ func (req *CreateWorkerRequest) isValid() bool {
 		//Reserved alias
 		return false
 	}
+	if !isTagListValid(req.Tags) {
+		return false
+	}
 
 	return true
 }
 
+func isTagListValid(tags []string) bool {
+	if len(tags) > MaxTags {
+		return false
+	}
+	for _, tag := range tags {
+		if len(tag) == 0 || len(tag) > MaxTagLength {
+			return false
+		}
+	}
+	return true
+}
+
 type CreateWorkerResponse struct {
 	Worker *storage.Worker `json:"worker,omitempty"`
 }
@@ -338,6 +736,83 @@ type GetWebhookSecretResponse struct {
 	WebhookSecret string `json:"webhook_secret"`
 }
 
+type GetFailedTasksResponse struct {
+	Tasks []storage.FailedTask `json:"tasks"`
+}
+
+type GetArchivedTasksResponse struct {
+	Tasks []storage.ArchivedTask `json:"tasks"`
+}
+
+type SubmitStatus int
+
+const (
+	SUBMIT_INSERTED           SubmitStatus = 0
+	SUBMIT_DUPLICATE          SubmitStatus = 1
+	SUBMIT_RECENTLY_COMPLETED SubmitStatus = 2
+	SUBMIT_INVALID            SubmitStatus = 3
+	SUBMIT_FAILED             SubmitStatus = 4
+)
+
+// Id is only set for SUBMIT_INSERTED
+type BulkSubmitTaskResult struct {
+	Id      int64        `json:"id,omitempty"`
+	Status  SubmitStatus `json:"status"`
+	Message string       `json:"message,omitempty"`
+}
+
+// Results are in the same order as the requests of the bulk submit
+type BulkSubmitTaskResponse struct {
+	Results []BulkSubmitTaskResult `json:"results"`
+}
+
+type GetResultsResponse struct {
+	Results []storage.TaskResultRecord `json:"results"`
+}
+
+type GetTasksRequest struct {
+	Filter storage.TaskFilter `json:"filter"`
+	After  int64              `json:"after"`
+	Count  int                `json:"count"`
+}
+
+func (req *GetTasksRequest) IsValid() bool {
+	return req.Count > 0 && req.Count <= MaxBulkGetCount &&
+		req.After >= 0 && isTaskFilterValid(&req.Filter)
+}
+
+func isTaskFilterValid(filter *storage.TaskFilter) bool {
+	return filter.Id >= 0 && filter.Status >= 0 && filter.Assignee >= -1
+}
+
+// An empty filter matches every task of the project
+func isTaskFilterEmpty(filter *storage.TaskFilter) bool {
+	return filter.Id == 0 && filter.Status == 0 && filter.Assignee == 0 &&
+		filter.MinPriority == nil && filter.MaxPriority == nil &&
+		filter.MinRetries == nil && filter.MaxRetries == nil && filter.Recipe == ""
+}
+
+// The filter is ignored when the request targets a single task
+type EditTasksRequest struct {
+	Filter     storage.TaskFilter `json:"filter"`
+	Priority   *int16             `json:"priority"`
+	MaxRetries *int16             `json:"max_retries"`
+	Project    int64              `json:"project"`
+}
+
+func (req *EditTasksRequest) IsValid() bool {
+	return isTaskFilterValid(&req.Filter) && req.Project >= 0 &&
+		(req.MaxRetries == nil || *req.MaxRetries >= 0)
+}
+
+type EditTasksResponse struct {
+	AffectedTasks int64 `json:"affected_tasks"`
+}
+
+type GetTaskDetailsResponse struct {
+	Details *storage.TaskDetails `json:"details"`
+}
+
 type ResetFailedTaskResponse struct {
 	AffectedTasks int64 `json:"affected_tasks"`
 }
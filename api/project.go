@@ -70,6 +70,9 @@ func (api *WebAPI) CreateProject(r *Request) {
 	if createReq.SubmitRate == 0 {
 		createReq.SubmitRate = rate.Inf
 	}
+	if createReq.RetryMultiplier == 0 {
+		createReq.RetryMultiplier = 1
+	}
 	project := &storage.Project{
 		Name:       createReq.Name,
 		Version:    createReq.Version,
@@ -82,6 +85,24 @@ func (api *WebAPI) CreateProject(r *Request) {
 		Chain:      createReq.Chain,
 		AssignRate: createReq.AssignRate,
 		SubmitRate: createReq.SubmitRate,
+
+		RetryDelay:      createReq.RetryDelay,
+		RetryMultiplier: createReq.RetryMultiplier,
+		RetryMaxDelay:   createReq.RetryMaxDelay,
+
+		Chains:                    createReq.Chains,
+		AssignStrategy:            createReq.AssignStrategy,
+		MaxInFlightPerGroup:       createReq.MaxInFlightPerGroup,
+		DefaultMaxConcurrentTasks: createReq.DefaultMaxConcurrentTasks,
+		DedupMode:                 createReq.DedupMode,
+		DedupTtl:                  createReq.DedupTtl,
+		MaxVerificationAttempts:   createReq.MaxVerificationAttempts,
+		MinReputation:             createReq.MinReputation,
+		TrustedReputation:         createReq.TrustedReputation,
+		TrustedVerificationCount:  createReq.TrustedVerificationCount,
+		KeepCompletedTasks:        createReq.KeepCompletedTasks,
+		ArchiveTasks:              createReq.ArchiveTasks,
+		RecipeSchema:              createReq.RecipeSchema,
 	}
 
 	if !createReq.isValid() {
@@ -157,6 +178,21 @@ func (api *WebAPI) UpdateProject(r *Request) {
 		return
 	}
 
+	current := api.Database.GetProject(id)
+	if current == nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Project not found",
+		}, 404)
+		return
+	}
+	updateReq.keepUnchanged(current)
+
+	if *updateReq.RetryMultiplier == 0 {
+		retryMultiplier := float64(1)
+		updateReq.RetryMultiplier = &retryMultiplier
+	}
+
 	if !updateReq.isValid(id) {
 		r.Json(JsonResponse{
 			Ok:      false,
@@ -185,6 +221,24 @@ func (api *WebAPI) UpdateProject(r *Request) {
 		AssignRate: updateReq.AssignRate,
 		SubmitRate: updateReq.SubmitRate,
 		Version:    updateReq.Version,
+
+		RetryDelay:      *updateReq.RetryDelay,
+		RetryMultiplier: *updateReq.RetryMultiplier,
+		RetryMaxDelay:   *updateReq.RetryMaxDelay,
+
+		Chains:                    updateReq.Chains,
+		AssignStrategy:            *updateReq.AssignStrategy,
+		MaxInFlightPerGroup:       *updateReq.MaxInFlightPerGroup,
+		DefaultMaxConcurrentTasks: *updateReq.DefaultMaxConcurrentTasks,
+		DedupMode:                 *updateReq.DedupMode,
+		DedupTtl:                  *updateReq.DedupTtl,
+		MaxVerificationAttempts:   *updateReq.MaxVerificationAttempts,
+		MinReputation:             *updateReq.MinReputation,
+		TrustedReputation:         *updateReq.TrustedReputation,
+		TrustedVerificationCount:  *updateReq.TrustedVerificationCount,
+		KeepCompletedTasks:        *updateReq.KeepCompletedTasks,
+		ArchiveTasks:              *updateReq.ArchiveTasks,
+		RecipeSchema:              *updateReq.RecipeSchema,
 	}
 	sess, _ := api.Session.Get(r.Ctx)
 	manager := sess.Get("manager")
@@ -205,6 +259,24 @@ func (api *WebAPI) UpdateProject(r *Request) {
 		return
 	}
 
+	for _, chain := range project.Chains {
+		if !isActionOnProjectAuthorized(chain.Target, manager, storage.RoleEdit, api.Database) {
+			r.Json(JsonResponse{
+				Ok:      false,
+				Message: "Unauthorized (You need RoleEdit on the project you wish to chain tasks to)",
+			}, 403)
+			return
+		}
+	}
+
+	if api.hasChainCycle(project) {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Chain configuration contains a cycle",
+		}, 400)
+		return
+	}
+
 	err = api.Database.UpdateProject(project)
 	if err != nil {
 		r.Json(JsonResponse{
@@ -218,6 +290,7 @@ func (api *WebAPI) UpdateProject(r *Request) {
 	} else {
 		api.SubmitLimiters.Delete(project.Id)
 		api.AssignLimiters.Delete(project.Id)
+		api.RecipeSchemas.Delete(project.Id)
 
 		r.OkJson(JsonResponse{
 			Ok: true,
@@ -251,9 +324,58 @@ func (api *WebAPI) isProjectCreationAuthorized(project *storage.Project, manager
 		}
 	}
 
+	for _, chain := range project.Chains {
+		chainsTo := api.Database.GetProject(chain.Target)
+		if chainsTo == nil {
+			return false
+		}
+
+		if !isActionOnProjectAuthorized(chainsTo.Id, manager.(*storage.Manager),
+			storage.RoleEdit, api.Database) {
+			return false
+		}
+	}
+
 	return true
 }
 
+// Checks if the project can reach itself once its chain
+// configuration is replaced by the one of the update
+func (api *WebAPI) hasChainCycle(project *storage.Project) bool {
+
+	graph := api.Database.GetChainGraph()
+	if graph == nil {
+		return true
+	}
+
+	targets := make([]int64, 0, len(project.Chains)+1)
+	if project.Chain != 0 {
+		targets = append(targets, project.Chain)
+	}
+	for _, chain := range project.Chains {
+		targets = append(targets, chain.Target)
+	}
+	graph[project.Id] = targets
+
+	visited := make(map[int64]bool)
+	stack := append([]int64{}, targets...)
+	for len(stack) != 0 {
+		pid := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if pid == project.Id {
+			return true
+		}
+		if visited[pid] {
+			continue
+		}
+		visited[pid] = true
+		stack = append(stack, graph[pid]...)
+	}
+
+	return false
+}
+
 func isActionOnProjectAuthorized(project int64, manager interface{},
 	requiredRole storage.ManagerRole, db *storage.Database) bool {
 
@@ -706,6 +828,90 @@ func (api *WebAPI) SetWebhookSecret(r *Request) {
 	}
 }
 
+func (api *WebAPI) GetFailedTasks(r *Request) {
+
+	pid, err := strconv.ParseInt(r.Ctx.UserValue("id").(string), 10, 64)
+	if err != nil || pid <= 0 {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid project id",
+		}, 400)
+		return
+	}
+
+	count := r.Ctx.Request.URI().QueryArgs().GetUintOrZero("count")
+	after := r.Ctx.Request.URI().QueryArgs().GetUintOrZero("after")
+	if count <= 0 || count > MaxBulkGetCount {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid request",
+		}, 400)
+		return
+	}
+
+	sess, _ := api.Session.Get(r.Ctx)
+	manager := sess.Get("manager")
+
+	if !isActionOnProjectAuthorized(pid, manager, storage.RoleRead, api.Database) {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Unauthorized",
+		}, 403)
+		return
+	}
+
+	tasks := api.Database.GetFailedTasks(pid, int64(after), count)
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+		Content: GetFailedTasksResponse{
+			Tasks: tasks,
+		},
+	})
+}
+
+func (api *WebAPI) GetArchivedTasks(r *Request) {
+
+	pid, err := strconv.ParseInt(r.Ctx.UserValue("id").(string), 10, 64)
+	if err != nil || pid <= 0 {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid project id",
+		}, 400)
+		return
+	}
+
+	count := r.Ctx.Request.URI().QueryArgs().GetUintOrZero("count")
+	after := r.Ctx.Request.URI().QueryArgs().GetUintOrZero("after")
+	if count <= 0 || count > MaxBulkGetCount {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid request",
+		}, 400)
+		return
+	}
+
+	sess, _ := api.Session.Get(r.Ctx)
+	manager := sess.Get("manager")
+
+	if !isActionOnProjectAuthorized(pid, manager, storage.RoleRead, api.Database) {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Unauthorized",
+		}, 403)
+		return
+	}
+
+	tasks := api.Database.GetArchivedTasks(pid, int64(after), count)
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+		Content: GetArchivedTasksResponse{
+			Tasks: tasks,
+		},
+	})
+}
+
 func (api *WebAPI) ResetFailedTasks(r *Request) {
 
 	pid, err := strconv.ParseInt(r.Ctx.UserValue("id").(string), 10, 64)
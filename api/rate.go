@@ -21,7 +21,7 @@ func (api *WebAPI) ReserveSubmit(pid int64, count int) *rate.Reservation {
 	return limiter.(*rate.Limiter).ReserveN(time.Now(), count)
 }
 
-func (api *WebAPI) ReserveAssign(pid int64) *rate.Reservation {
+func (api *WebAPI) ReserveAssign(pid int64, count int) *rate.Reservation {
 
 	limiter, ok := api.AssignLimiters.Load(pid)
 	if !ok {
@@ -34,5 +34,5 @@ func (api *WebAPI) ReserveAssign(pid int64) *rate.Reservation {
 		api.AssignLimiters.Store(pid, limiter)
 	}
 
-	return limiter.(*rate.Limiter).ReserveN(time.Now(), 1)
+	return limiter.(*rate.Limiter).ReserveN(time.Now(), count)
 }
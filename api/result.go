@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/simon987/task_tracker/storage"
+	"github.com/sirupsen/logrus"
+	"strconv"
+)
+
+func (api *WebAPI) GetResults(r *Request) {
+
+	pid, err := strconv.ParseInt(r.Ctx.UserValue("id").(string), 10, 64)
+	if err != nil || pid <= 0 {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid project id",
+		}, 400)
+		return
+	}
+
+	count := r.Ctx.Request.URI().QueryArgs().GetUintOrZero("count")
+	after := r.Ctx.Request.URI().QueryArgs().GetUintOrZero("after")
+	if count <= 0 || count > MaxBulkGetCount {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid request",
+		}, 400)
+		return
+	}
+
+	sess, _ := api.Session.Get(r.Ctx)
+	manager := sess.Get("manager")
+
+	if !isActionOnProjectAuthorized(pid, manager, storage.RoleRead, api.Database) {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Unauthorized",
+		}, 403)
+		return
+	}
+
+	results := api.Database.GetResults(pid, int64(after), count)
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+		Content: GetResultsResponse{
+			Results: results,
+		},
+	})
+}
+
+// Writes all the results of a project as newline-delimited JSON
+func (api *WebAPI) ExportResults(r *Request) {
+
+	pid, err := strconv.ParseInt(r.Ctx.UserValue("id").(string), 10, 64)
+	if err != nil || pid <= 0 {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid project id",
+		}, 400)
+		return
+	}
+
+	sess, _ := api.Session.Get(r.Ctx)
+	manager := sess.Get("manager")
+
+	if !isActionOnProjectAuthorized(pid, manager, storage.RoleRead, api.Database) {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Unauthorized",
+		}, 403)
+		return
+	}
+
+	r.Ctx.Response.Header.Set("Content-Type", "application/x-ndjson")
+	r.Ctx.Response.Header.Set("Content-Disposition",
+		"attachment; filename=\"results_"+strconv.FormatInt(pid, 10)+".ndjson\"")
+
+	// The rows are written as they are read, the response can't be
+	// turned into an error once the first result has been sent
+	r.Ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		encoder := json.NewEncoder(w)
+		err := api.Database.ExportResults(pid, func(result *storage.TaskResultRecord) error {
+			return encoder.Encode(result)
+		})
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"project": pid,
+			}).Error("Could not export results")
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"project": pid,
+		}).Info("Exported results")
+	})
+}
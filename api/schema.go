@@ -0,0 +1,369 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// Subset of JSON Schema used to validate the recipes submitted to a project.
+// Supported keywords: type, enum, const, properties, required,
+// additionalProperties, items, minItems, maxItems, minLength, maxLength,
+// pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum.
+// Annotations ($schema, $id, $comment, title, description, default, examples)
+// are ignored, schemas that use any other keyword are rejected
+type recipeSchema struct {
+	types                []string
+	enum                 []interface{}
+	constValue           *interface{}
+	properties           map[string]*recipeSchema
+	required             []string
+	additionalProperties *recipeSchema
+	noAdditional         bool
+	items                *recipeSchema
+	minItems             *int
+	maxItems             *int
+	minLength            *int
+	maxLength            *int
+	pattern              *regexp.Regexp
+	minimum              *float64
+	maximum              *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+}
+
+type rawRecipeSchema struct {
+	Type                 json.RawMessage            `json:"type"`
+	Enum                 []interface{}              `json:"enum"`
+	Const                json.RawMessage            `json:"const"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	Pattern              *string                    `json:"pattern"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	ExclusiveMinimum     *float64                   `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64                   `json:"exclusiveMaximum"`
+}
+
+var schemaKeywords = map[string]bool{
+	"type": true, "enum": true, "const": true, "properties": true, "required": true,
+	"additionalProperties": true, "items": true, "minItems": true, "maxItems": true,
+	"minLength": true, "maxLength": true, "pattern": true, "minimum": true, "maximum": true,
+	"exclusiveMinimum": true, "exclusiveMaximum": true,
+
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true,
+}
+
+var schemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// Returns nil if the schema is empty (recipes are not validated)
+func compileRecipeSchema(schema string) (*recipeSchema, error) {
+	if len(schema) == 0 {
+		return nil, nil
+	}
+	return compileSchemaNode([]byte(schema))
+}
+
+func compileSchemaNode(data []byte) (*recipeSchema, error) {
+
+	var keywords map[string]json.RawMessage
+	err := json.Unmarshal(data, &keywords)
+	if err != nil || keywords == nil {
+		return nil, errors.New("schema must be a JSON object")
+	}
+	unsupported := make([]string, 0)
+	for keyword := range keywords {
+		if !schemaKeywords[keyword] {
+			unsupported = append(unsupported, keyword)
+		}
+	}
+	if len(unsupported) != 0 {
+		sort.Strings(unsupported)
+		return nil, fmt.Errorf("unsupported keyword '%s'", unsupported[0])
+	}
+
+	raw := rawRecipeSchema{}
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, errors.New("schema must be a JSON object")
+	}
+
+	s := &recipeSchema{
+		enum:      raw.Enum,
+		required:  raw.Required,
+		minItems:  raw.MinItems,
+		maxItems:  raw.MaxItems,
+		minLength: raw.MinLength,
+		maxLength: raw.MaxLength,
+		minimum:   raw.Minimum,
+		maximum:   raw.Maximum,
+
+		exclusiveMinimum: raw.ExclusiveMinimum,
+		exclusiveMaximum: raw.ExclusiveMaximum,
+	}
+
+	if len(raw.Type) != 0 {
+		var t string
+		if json.Unmarshal(raw.Type, &t) == nil {
+			s.types = []string{t}
+		} else if json.Unmarshal(raw.Type, &s.types) != nil {
+			return nil, errors.New("type must be a string or a list of strings")
+		}
+		for _, t := range s.types {
+			if !schemaTypes[t] {
+				return nil, fmt.Errorf("unknown type '%s'", t)
+			}
+		}
+	}
+
+	if len(raw.Const) != 0 {
+		var c interface{}
+		_ = json.Unmarshal(raw.Const, &c)
+		s.constValue = &c
+	}
+
+	if raw.Pattern != nil {
+		s.pattern, err = regexp.Compile(*raw.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %s", err.Error())
+		}
+	}
+
+	if raw.Properties != nil {
+		s.properties = make(map[string]*recipeSchema, len(raw.Properties))
+		for name, prop := range raw.Properties {
+			s.properties[name], err = compileSchemaNode(prop)
+			if err != nil {
+				return nil, fmt.Errorf("properties.%s: %s", name, err.Error())
+			}
+		}
+	}
+
+	if len(raw.AdditionalProperties) != 0 {
+		var allowed bool
+		if json.Unmarshal(raw.AdditionalProperties, &allowed) == nil {
+			s.noAdditional = !allowed
+		} else {
+			s.additionalProperties, err = compileSchemaNode(raw.AdditionalProperties)
+			if err != nil {
+				return nil, fmt.Errorf("additionalProperties: %s", err.Error())
+			}
+		}
+	}
+
+	if len(raw.Items) != 0 {
+		s.items, err = compileSchemaNode(raw.Items)
+		if err != nil {
+			return nil, fmt.Errorf("items: %s", err.Error())
+		}
+	}
+
+	return s, nil
+}
+
+// The recipe must be a JSON document that matches the schema
+func (s *recipeSchema) validate(recipe string) error {
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(recipe)))
+	if decoder.Decode(&value) != nil || decoder.More() {
+		return errors.New("recipe is not valid JSON")
+	}
+
+	return s.validateValue("recipe", value)
+}
+
+func (s *recipeSchema) validateValue(path string, value interface{}) error {
+
+	if len(s.types) != 0 && !s.matchesType(value) {
+		return fmt.Errorf("%s: expected %v", path, s.types)
+	}
+
+	if s.constValue != nil && !reflect.DeepEqual(*s.constValue, value) {
+		return fmt.Errorf("%s: does not match const", path)
+	}
+
+	if s.enum != nil {
+		found := false
+		for _, e := range s.enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: not one of the enum values", path)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return s.validateObject(path, v)
+	case []interface{}:
+		return s.validateArray(path, v)
+	case string:
+		return s.validateString(path, v)
+	case float64:
+		return s.validateNumber(path, v)
+	}
+	return nil
+}
+
+func (s *recipeSchema) matchesType(value interface{}) bool {
+	for _, t := range s.types {
+		switch value.(type) {
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && value.(float64) == math.Trunc(value.(float64))) {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case nil:
+			if t == "null" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *recipeSchema) validateObject(path string, obj map[string]interface{}) error {
+
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			return fmt.Errorf("%s: missing required property '%s'", path, name)
+		}
+	}
+
+	for name, value := range obj {
+		propPath := path + "." + name
+		if prop, ok := s.properties[name]; ok {
+			if err := prop.validateValue(propPath, value); err != nil {
+				return err
+			}
+		} else if s.noAdditional {
+			return fmt.Errorf("%s: additional property '%s' is not allowed", path, name)
+		} else if s.additionalProperties != nil {
+			if err := s.additionalProperties.validateValue(propPath, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *recipeSchema) validateArray(path string, arr []interface{}) error {
+
+	if s.minItems != nil && len(arr) < *s.minItems {
+		return fmt.Errorf("%s: expected at least %d items", path, *s.minItems)
+	}
+	if s.maxItems != nil && len(arr) > *s.maxItems {
+		return fmt.Errorf("%s: expected at most %d items", path, *s.maxItems)
+	}
+	if s.items != nil {
+		for i, item := range arr {
+			if err := s.items.validateValue(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *recipeSchema) validateString(path string, str string) error {
+
+	length := utf8.RuneCountInString(str)
+	if s.minLength != nil && length < *s.minLength {
+		return fmt.Errorf("%s: expected at least %d characters", path, *s.minLength)
+	}
+	if s.maxLength != nil && length > *s.maxLength {
+		return fmt.Errorf("%s: expected at most %d characters", path, *s.maxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		return fmt.Errorf("%s: does not match pattern '%s'", path, s.pattern.String())
+	}
+	return nil
+}
+
+func (s *recipeSchema) validateNumber(path string, n float64) error {
+
+	if s.minimum != nil && n < *s.minimum {
+		return fmt.Errorf("%s: must be >= %v", path, *s.minimum)
+	}
+	if s.maximum != nil && n > *s.maximum {
+		return fmt.Errorf("%s: must be <= %v", path, *s.maximum)
+	}
+	if s.exclusiveMinimum != nil && n <= *s.exclusiveMinimum {
+		return fmt.Errorf("%s: must be > %v", path, *s.exclusiveMinimum)
+	}
+	if s.exclusiveMaximum != nil && n >= *s.exclusiveMaximum {
+		return fmt.Errorf("%s: must be < %v", path, *s.exclusiveMaximum)
+	}
+	return nil
+}
+
+type cachedRecipeSchema struct {
+	source   string
+	compiled *recipeSchema
+}
+
+// The schema is read from the project cache, it is only compiled again when it changed
+func (api *WebAPI) getRecipeSchema(pid int64) *recipeSchema {
+
+	project := api.Database.GetProject(pid)
+	if project == nil || project.RecipeSchema == "" {
+		return nil
+	}
+	source := project.RecipeSchema
+
+	cached, ok := api.RecipeSchemas.Load(pid)
+	if ok && cached.(*cachedRecipeSchema).source == source {
+		return cached.(*cachedRecipeSchema).compiled
+	}
+
+	compiled, err := compileRecipeSchema(source)
+	if err != nil {
+		// Schemas are checked when the project is saved
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"project": pid,
+		}).Error("Could not compile recipe schema")
+		return nil
+	}
+	api.RecipeSchemas.Store(pid, &cachedRecipeSchema{
+		source:   source,
+		compiled: compiled,
+	})
+
+	return compiled
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/dchest/siphash"
 	"github.com/simon987/task_tracker/storage"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 	"strconv"
 	"time"
 )
@@ -48,15 +49,6 @@ func (api *WebAPI) SubmitTask(r *Request) {
 		return
 	}
 
-	task := &storage.Task{
-		MaxRetries:        createReq.MaxRetries,
-		Recipe:            string(createReq.Recipe),
-		Priority:          createReq.Priority,
-		AssignTime:        0,
-		MaxAssignTime:     createReq.MaxAssignTime,
-		VerificationCount: createReq.VerificationCount,
-	}
-
 	reservation := api.ReserveSubmit(createReq.Project, 1)
 	if reservation == nil {
 		r.Json(JsonResponse{
@@ -76,11 +68,31 @@ func (api *WebAPI) SubmitTask(r *Request) {
 		return
 	}
 
-	if len(createReq.UniqueString) != 0 {
-		createReq.Hash64 = int64(siphash.Hash(1, 2, []byte(createReq.UniqueString)))
+	if !api.Database.HasSubmitAccess(worker.Id, createReq.Project) {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "unauthorized task submit",
+		}, 400)
+		reservation.Cancel()
+		return
+	}
+
+	if schema := api.getRecipeSchema(createReq.Project); schema != nil {
+		err = schema.validate(createReq.Recipe)
+		if err != nil {
+			r.Json(JsonResponse{
+				Ok:      false,
+				Message: "Invalid recipe: " + err.Error(),
+			}, 400)
+			reservation.Cancel()
+			return
+		}
 	}
 
-	err = api.Database.SaveTask(task, createReq.Project, createReq.Hash64, worker.Id)
+	saveReq := makeSaveTaskRequest(createReq, worker.Id)
+
+	id, err := api.Database.SaveTask(saveReq.Task, saveReq.Project, saveReq.Hash64, worker.Id,
+		saveReq.Dependencies)
 
 	if err != nil {
 		r.Json(JsonResponse{
@@ -93,9 +105,90 @@ func (api *WebAPI) SubmitTask(r *Request) {
 
 	r.OkJson(JsonResponse{
 		Ok: true,
+		Content: SubmitTaskResponse{
+			Id: id,
+		},
 	})
 }
 
+func makeSubmitResult(res storage.SaveTaskResult) BulkSubmitTaskResult {
+
+	result := BulkSubmitTaskResult{}
+	switch res.Err {
+	case nil:
+		result.Id = res.Id
+		result.Status = SUBMIT_INSERTED
+	case storage.ErrDuplicateTask:
+		result.Status = SUBMIT_DUPLICATE
+	case storage.ErrRecentlyCompleted:
+		result.Status = SUBMIT_RECENTLY_COMPLETED
+	case storage.ErrUnresolvedDependency, storage.ErrFailedDependency:
+		result.Status = SUBMIT_INVALID
+	default:
+		// Database errors are logged, not returned to the worker
+		logrus.WithError(res.Err).Error("Could not save task")
+		result.Status = SUBMIT_FAILED
+		result.Message = "Could not save task"
+		return result
+	}
+	if res.Err != nil {
+		result.Message = res.Err.Error()
+	}
+	return result
+}
+
+func makeSaveTaskRequest(req *SubmitTaskRequest, workerId int64) storage.SaveTaskRequest {
+
+	if len(req.UniqueString) != 0 {
+		req.Hash64 = int64(siphash.Hash(1, 2, []byte(req.UniqueString)))
+	}
+	if req.VerificationCount == 0 {
+		req.VerificationCount = 1
+	}
+
+	return storage.SaveTaskRequest{
+		Task: &storage.Task{
+			MaxRetries:        req.MaxRetries,
+			Recipe:            string(req.Recipe),
+			Priority:          req.Priority,
+			AssignTime:        0,
+			MaxAssignTime:     req.MaxAssignTime,
+			VerificationCount: req.VerificationCount,
+			NotBefore:         req.NotBefore,
+			Group:             req.Group,
+			RequiredTags:      req.RequiredTags,
+		},
+		Project:      req.Project,
+		WorkerId:     workerId,
+		Hash64:       req.Hash64,
+		Dependencies: makeDependencies(req),
+	}
+}
+
+func makeDependencies(req *SubmitTaskRequest) []storage.TaskDependency {
+
+	if len(req.Dependencies) == 0 {
+		return nil
+	}
+
+	dependencies := make([]storage.TaskDependency, len(req.Dependencies))
+	for i, dep := range req.Dependencies {
+		dependencies[i] = storage.TaskDependency{
+			TaskId:         dep.TaskId,
+			Project:        dep.Project,
+			CascadeFailure: dep.CascadeFailure,
+		}
+		if dep.Project == 0 {
+			dependencies[i].Project = req.Project
+		}
+		if len(dep.UniqueString) != 0 {
+			dependencies[i].Hash64 = int64(siphash.Hash(1, 2, []byte(dep.UniqueString)))
+		}
+	}
+
+	return dependencies
+}
+
 func (api *WebAPI) BulkSubmitTask(r *Request) {
 
 	worker, err := api.validateSecret(r)
@@ -127,10 +220,8 @@ func (api *WebAPI) BulkSubmitTask(r *Request) {
 		return
 	}
 
-	saveRequests := make([]storage.SaveTaskRequest, len(createReq.Requests))
 	projectId := createReq.Requests[0].Project
-	for i, req := range createReq.Requests {
-
+	for _, req := range createReq.Requests {
 		if req.Project != projectId {
 			r.Json(JsonResponse{
 				Ok:      false,
@@ -138,27 +229,54 @@ func (api *WebAPI) BulkSubmitTask(r *Request) {
 			}, 400)
 			return
 		}
+	}
 
-		if len(req.UniqueString) != 0 {
-			req.Hash64 = int64(siphash.Hash(1, 2, []byte(req.UniqueString)))
+	if !api.Database.HasSubmitAccess(worker.Id, projectId) {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Unauthorized task submit",
+		}, 403)
+		return
+	}
+
+	// Invalid requests are skipped, indices maps the
+	// saved requests to their index in the bulk submit
+	results := make([]BulkSubmitTaskResult, len(createReq.Requests))
+	saveRequests := make([]storage.SaveTaskRequest, 0, len(createReq.Requests))
+	indices := make([]int, 0, len(createReq.Requests))
+	schema := api.getRecipeSchema(projectId)
+	for i, req := range createReq.Requests {
+
+		if !req.IsValid() {
+			results[i] = BulkSubmitTaskResult{
+				Status:  SUBMIT_INVALID,
+				Message: "Invalid task",
+			}
+			continue
 		}
-		if req.VerificationCount == 0 {
-			req.VerificationCount = 1
+		if schema != nil {
+			err = schema.validate(req.Recipe)
+			if err != nil {
+				results[i] = BulkSubmitTaskResult{
+					Status:  SUBMIT_INVALID,
+					Message: "Invalid recipe: " + err.Error(),
+				}
+				continue
+			}
 		}
 
-		saveRequests[i] = storage.SaveTaskRequest{
-			Task: &storage.Task{
-				MaxRetries:        req.MaxRetries,
-				Recipe:            string(req.Recipe),
-				Priority:          req.Priority,
-				AssignTime:        0,
-				MaxAssignTime:     req.MaxAssignTime,
-				VerificationCount: req.VerificationCount,
+		saveRequests = append(saveRequests, makeSaveTaskRequest(&req, worker.Id))
+		indices = append(indices, i)
+	}
+
+	if len(saveRequests) == 0 {
+		r.OkJson(JsonResponse{
+			Ok: true,
+			Content: BulkSubmitTaskResponse{
+				Results: results,
 			},
-			Project:  projectId,
-			WorkerId: worker.Id,
-			Hash64:   req.Hash64,
-		}
+		})
+		return
 	}
 
 	reservation := api.ReserveSubmit(projectId, len(saveRequests))
@@ -180,21 +298,112 @@ func (api *WebAPI) BulkSubmitTask(r *Request) {
 		return
 	}
 
-	saveErrors := api.Database.BulkSaveTask(saveRequests)
-
-	if saveErrors == nil {
+	saveResults, err := api.Database.BulkSaveTask(saveRequests)
+	if err != nil {
 		r.Json(JsonResponse{
 			Ok:      false,
 			Message: "Fatal error during bulk insert, see server logs",
-		}, 400)
+		}, 500)
 		reservation.Cancel()
 		return
 	}
 
-	logrus.Info(saveErrors)
+	for j, res := range saveResults {
+		results[indices[j]] = makeSubmitResult(res)
+	}
 
 	r.OkJson(JsonResponse{
 		Ok: true,
+		Content: BulkSubmitTaskResponse{
+			Results: results,
+		},
+	})
+}
+
+func (api *WebAPI) GetTask(r *Request) {
+
+	worker, err := api.validateSecret(r)
+	if err != nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: err.Error(),
+		}, 403)
+		return
+	}
+
+	if worker.Paused {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "A manager has paused you",
+		}, 400)
+		return
+	}
+
+	// Projects are tried in a random order weighted by their priority, tasks
+	// within a project are picked by descending priority by GetTaskFromProject
+	var minDelay float64
+	var assigned int64 = -1
+	limitReached := false
+	for _, project := range api.Database.GetAssignableProjects(worker) {
+
+		if limit := api.maxConcurrentTasks(worker, project); limit != 0 {
+			if assigned < 0 {
+				assigned = api.Database.GetAssignedTaskCount(worker.Id)
+			}
+			if assigned >= limit {
+				limitReached = true
+				continue
+			}
+		}
+
+		reservation := api.ReserveAssign(project, 1)
+		if reservation == nil {
+			continue
+		}
+		delay := reservation.DelayFrom(time.Now()).Seconds()
+		if delay > 0 {
+			if minDelay == 0 || delay < minDelay {
+				minDelay = delay
+			}
+			reservation.Cancel()
+			continue
+		}
+
+		task := api.Database.GetTaskFromProject(worker, project)
+		if task == nil {
+			reservation.CancelAt(time.Now())
+			continue
+		}
+
+		r.OkJson(JsonResponse{
+			Ok: true,
+			Content: GetTaskResponse{
+				Task: task,
+			},
+		})
+		return
+	}
+
+	if minDelay > 0 {
+		r.Json(JsonResponse{
+			Ok:             false,
+			Message:        "Too many requests",
+			RateLimitDelay: minDelay,
+		}, 429)
+		return
+	}
+
+	if limitReached {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Too many assigned tasks",
+		}, 400)
+		return
+	}
+
+	r.OkJson(JsonResponse{
+		Ok:      false,
+		Message: "No task available",
 	})
 }
 
@@ -226,7 +435,24 @@ func (api *WebAPI) GetTaskFromProject(r *Request) {
 		return
 	}
 
-	reservation := api.ReserveAssign(project)
+	wait, ok := parseWait(r)
+	if !ok {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid wait",
+		}, 400)
+		return
+	}
+
+	if api.remainingTaskSlots(worker, project) == 0 {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Too many assigned tasks",
+		}, 400)
+		return
+	}
+
+	reservation := api.ReserveAssign(project, 1)
 	if reservation == nil {
 		r.Json(JsonResponse{
 			Ok:      false,
@@ -245,9 +471,9 @@ func (api *WebAPI) GetTaskFromProject(r *Request) {
 		return
 	}
 
-	task := api.Database.GetTaskFromProject(worker, project)
+	tasks := api.Database.GetTasksFromProjectWait(worker, project, 1, wait)
 
-	if task == nil {
+	if len(tasks) == 0 {
 		r.OkJson(JsonResponse{
 			Ok:      false,
 			Message: "No task available",
@@ -259,11 +485,151 @@ func (api *WebAPI) GetTaskFromProject(r *Request) {
 	r.OkJson(JsonResponse{
 		Ok: true,
 		Content: GetTaskResponse{
-			Task: task,
+			Task: &tasks[0],
 		},
 	})
 }
 
+func (api *WebAPI) GetTasksFromProject(r *Request) {
+
+	worker, err := api.validateSecret(r)
+	if err != nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: err.Error(),
+		}, 403)
+		return
+	}
+
+	if worker.Paused {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "A manager has paused you",
+		}, 400)
+		return
+	}
+
+	project, err := strconv.ParseInt(r.Ctx.UserValue("project").(string), 10, 64)
+	count := r.Ctx.Request.URI().QueryArgs().GetUintOrZero("count")
+	if err != nil || project <= 0 {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid project id",
+		}, 400)
+		return
+	}
+	if count <= 0 || count > MaxBulkGetCount {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid count",
+		}, 400)
+		return
+	}
+
+	wait, ok := parseWait(r)
+	if !ok {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid wait",
+		}, 400)
+		return
+	}
+
+	slots := api.remainingTaskSlots(worker, project)
+	if slots == 0 {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Too many assigned tasks",
+		}, 400)
+		return
+	}
+	if slots > 0 && slots < int64(count) {
+		count = int(slots)
+	}
+
+	reservation := api.ReserveAssign(project, count)
+	if reservation == nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Project not found",
+		}, 404)
+		return
+	}
+	delay := reservation.DelayFrom(time.Now()).Seconds()
+	if delay > 0 {
+		r.Json(JsonResponse{
+			Ok:             false,
+			Message:        "Too many requests",
+			RateLimitDelay: delay,
+		}, 429)
+		reservation.Cancel()
+		return
+	}
+
+	tasks := api.Database.GetTasksFromProjectWait(worker, project, count, wait)
+
+	if len(tasks) == 0 {
+		r.OkJson(JsonResponse{
+			Ok:      false,
+			Message: "No task available",
+		})
+		reservation.CancelAt(time.Now())
+		return
+	}
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+		Content: GetTasksResponse{
+			Tasks: tasks,
+		},
+	})
+}
+
+// Returns the maximum number of tasks the worker can hold at the same time
+// when getting tasks from this project, 0 for no limit
+func (api *WebAPI) maxConcurrentTasks(worker *storage.Worker, projectId int64) int64 {
+
+	if worker.MaxConcurrentTasks != 0 {
+		return worker.MaxConcurrentTasks
+	}
+
+	project := api.Database.GetProject(projectId)
+	if project == nil {
+		return 0
+	}
+	return project.DefaultMaxConcurrentTasks
+}
+
+// Returns how many more tasks the worker can be assigned, -1 for no limit
+func (api *WebAPI) remainingTaskSlots(worker *storage.Worker, projectId int64) int64 {
+
+	limit := api.maxConcurrentTasks(worker, projectId)
+	if limit == 0 {
+		return -1
+	}
+
+	remaining := limit - api.Database.GetAssignedTaskCount(worker.Id)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+func parseWait(r *Request) (time.Duration, bool) {
+
+	args := r.Ctx.Request.URI().QueryArgs()
+	if !args.Has("wait") {
+		return 0, true
+	}
+
+	wait, err := args.GetUint("wait")
+	if err != nil || wait > MaxWait {
+		return 0, false
+	}
+
+	return time.Duration(wait) * time.Second, true
+}
+
 func (api *WebAPI) validateSecret(r *Request) (*storage.Worker, error) {
 
 	widStr := string(r.Ctx.Request.Header.Peek("X-Worker-Id"))
@@ -335,23 +701,373 @@ func (api *WebAPI) ReleaseTask(r *Request) {
 		return
 	}
 
-	res := api.Database.ReleaseTask(req.TaskId, worker.Id, req.Result, req.Verification)
+	var childResults []BulkSubmitTaskResult
+	var childIndices []int
+	req.Children, childIndices, childResults = api.checkChildRecipes(req.Children)
+
+	reservations, ok := api.reserveChildren(r, worker, req.Children)
+	if !ok {
+		return
+	}
+
+	res := api.Database.ReleaseTask(req.toStorage(worker.Id), worker.Id)
+	if !res.Updated {
+		cancelReservations(reservations)
+	}
 
 	response := JsonResponse{
 		Ok: true,
 		Content: ReleaseTaskResponse{
-			Updated: res,
+			Updated:  res.Updated,
+			Children: makeChildResults(res.Updated, childResults, childIndices, res.Children),
 		},
 	}
 
-	if !res {
+	if res.Err != nil {
+		response.Message = "Error during release, see server logs"
+	} else if !res.Updated {
 		response.Message = "Task was not marked as closed"
 	}
 
 	logrus.WithFields(logrus.Fields{
 		"releaseTaskRequest": req,
-		"taskUpdated":        res,
+		"taskUpdated":        res.Updated,
 	}).Trace("Release task")
 
 	r.OkJson(response)
 }
+
+func (api *WebAPI) BulkReleaseTask(r *Request) {
+
+	worker, err := api.validateSecret(r)
+	if err != nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: err.Error(),
+		}, 403)
+		return
+	}
+
+	req := &BulkReleaseTaskRequest{}
+	err = json.Unmarshal(r.Ctx.Request.Body(), req)
+	if err != nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Could not parse request",
+		}, 400)
+		return
+	}
+
+	if !req.IsValid() {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid request",
+		}, 400)
+		return
+	}
+
+	releaseRequests := make([]storage.ReleaseRequest, 0, len(req.Requests))
+	children := make([]SubmitTaskRequest, 0)
+	childResults := make([][]BulkSubmitTaskResult, 0, len(req.Requests))
+	childIndices := make([][]int, 0, len(req.Requests))
+	for _, releaseReq := range req.Requests {
+		if releaseReq.IsValid() {
+			valid, indices, results := api.checkChildRecipes(releaseReq.Children)
+			releaseReq.Children = valid
+			releaseRequests = append(releaseRequests, releaseReq.toStorage(worker.Id))
+			children = append(children, valid...)
+			childResults = append(childResults, results)
+			childIndices = append(childIndices, indices)
+		}
+	}
+
+	reservations, ok := api.reserveChildren(r, worker, children)
+	if !ok {
+		return
+	}
+
+	released := api.Database.BulkReleaseTask(releaseRequests, worker.Id)
+	if released == nil {
+		cancelReservations(reservations)
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Fatal error during bulk release, see server logs",
+		}, 500)
+		return
+	}
+
+	results := make([]BulkReleaseTaskResult, len(req.Requests))
+	j := 0
+	for i, releaseReq := range req.Requests {
+		results[i].TaskId = releaseReq.TaskId
+
+		if !releaseReq.IsValid() {
+			results[i].Message = "Invalid request"
+			continue
+		}
+
+		results[i].Updated = released[j].Updated
+		results[i].Children = makeChildResults(released[j].Updated, childResults[j], childIndices[j],
+			released[j].Children)
+		if released[j].Err != nil {
+			results[i].Message = "Error during release, see server logs"
+		} else if !released[j].Updated {
+			results[i].Message = "Task was not marked as closed"
+		}
+		j++
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"bulkReleaseTaskRequest": req,
+	}).Trace("Bulk release task")
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+		Content: BulkReleaseTaskResponse{
+			Results: results,
+		},
+	})
+}
+
+// Children whose recipe doesn't match the schema of their project are not
+// submitted. Returns the children to submit, their index in the release and
+// the results of the children, only set for the rejected ones
+func (api *WebAPI) checkChildRecipes(children []SubmitTaskRequest) ([]SubmitTaskRequest, []int,
+	[]BulkSubmitTaskResult) {
+
+	valid := make([]SubmitTaskRequest, 0, len(children))
+	indices := make([]int, 0, len(children))
+	results := make([]BulkSubmitTaskResult, len(children))
+	for i := range children {
+		if schema := api.getRecipeSchema(children[i].Project); schema != nil {
+			err := schema.validate(children[i].Recipe)
+			if err != nil {
+				results[i] = BulkSubmitTaskResult{
+					Status:  SUBMIT_INVALID,
+					Message: "Invalid recipe: " + err.Error(),
+				}
+				continue
+			}
+		}
+		valid = append(valid, children[i])
+		indices = append(indices, i)
+	}
+
+	return valid, indices, results
+}
+
+// Children results are only set if the release closed the task
+func makeChildResults(updated bool, results []BulkSubmitTaskResult, indices []int,
+	saveResults []storage.SaveTaskResult) []BulkSubmitTaskResult {
+
+	if !updated || len(results) == 0 {
+		return nil
+	}
+
+	for j, res := range saveResults {
+		results[indices[j]] = makeSubmitResult(res)
+	}
+	return results
+}
+
+// Checks that the worker can submit the children of a release and
+// reserves the submit rate of their projects. Responds with an error
+// and returns false if the children can't be submitted right now
+func (api *WebAPI) reserveChildren(r *Request, worker *storage.Worker,
+	children []SubmitTaskRequest) ([]*rate.Reservation, bool) {
+
+	counts := make(map[int64]int)
+	for _, child := range children {
+		counts[child.Project]++
+	}
+
+	reservations := make([]*rate.Reservation, 0, len(counts))
+	var delay float64
+	for pid, count := range counts {
+		if !api.Database.HasSubmitAccess(worker.Id, pid) {
+			cancelReservations(reservations)
+			r.Json(JsonResponse{
+				Ok:      false,
+				Message: "Unauthorized child task submit",
+			}, 403)
+			return nil, false
+		}
+
+		reservation := api.ReserveSubmit(pid, count)
+		if reservation == nil {
+			cancelReservations(reservations)
+			r.Json(JsonResponse{
+				Ok:      false,
+				Message: "Project not found",
+			}, 404)
+			return nil, false
+		}
+		reservations = append(reservations, reservation)
+
+		if reservationDelay := reservation.DelayFrom(time.Now()).Seconds(); reservationDelay > delay {
+			delay = reservationDelay
+		}
+	}
+
+	if delay > 0 {
+		cancelReservations(reservations)
+		r.Json(JsonResponse{
+			Ok:             false,
+			Message:        "Too many requests",
+			RateLimitDelay: delay,
+		}, 429)
+		return nil, false
+	}
+
+	return reservations, true
+}
+
+func cancelReservations(reservations []*rate.Reservation) {
+	for _, reservation := range reservations {
+		reservation.Cancel()
+	}
+}
+
+func (api *WebAPI) TaskHeartbeat(r *Request) {
+
+	worker, err := api.validateSecret(r)
+	if err != nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: err.Error(),
+		}, 403)
+		return
+	}
+
+	req := &TaskHeartbeatRequest{}
+	err = json.Unmarshal(r.Ctx.Request.Body(), req)
+	if err != nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Could not parse request",
+		}, 400)
+		return
+	}
+
+	if !req.IsValid() {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid request",
+		}, 400)
+		return
+	}
+
+	leases := api.Database.ExtendTaskLease([]int64{req.TaskId}, worker.Id)
+	if leases == nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Could not extend lease, see server logs",
+		}, 500)
+		return
+	}
+
+	if !leases[0].Updated {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Task is not assigned to you",
+		}, 403)
+		return
+	}
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+		Content: TaskHeartbeatResponse{
+			LeaseRemaining: leases[0].LeaseRemaining,
+		},
+	})
+}
+
+func (api *WebAPI) BulkTaskHeartbeat(r *Request) {
+
+	worker, err := api.validateSecret(r)
+	if err != nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: err.Error(),
+		}, 403)
+		return
+	}
+
+	req := &BulkTaskHeartbeatRequest{}
+	err = json.Unmarshal(r.Ctx.Request.Body(), req)
+	if err != nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Could not parse request",
+		}, 400)
+		return
+	}
+
+	if !req.IsValid() {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid request",
+		}, 400)
+		return
+	}
+
+	leases := api.Database.ExtendTaskLease(req.TaskIds, worker.Id)
+	if leases == nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Could not extend lease, see server logs",
+		}, 500)
+		return
+	}
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+		Content: BulkTaskHeartbeatResponse{
+			Leases: leases,
+		},
+	})
+}
+
+func (api *WebAPI) SetTaskProgress(r *Request) {
+
+	worker, err := api.validateSecret(r)
+	if err != nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: err.Error(),
+		}, 403)
+		return
+	}
+
+	req := &TaskProgressRequest{}
+	err = json.Unmarshal(r.Ctx.Request.Body(), req)
+	if err != nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Could not parse request",
+		}, 400)
+		return
+	}
+
+	if !req.IsValid() {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid request",
+		}, 400)
+		return
+	}
+
+	ok := api.Database.SetTaskProgress(req.TaskId, worker.Id, req.Progress, req.Checkpoint)
+
+	if !ok {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Task is not assigned to you",
+		}, 403)
+		return
+	}
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+	})
+}
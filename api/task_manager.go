@@ -0,0 +1,307 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/simon987/task_tracker/storage"
+	"strconv"
+)
+
+func (api *WebAPI) GetTasks(r *Request) {
+
+	pid, err := strconv.ParseInt(r.Ctx.UserValue("id").(string), 10, 64)
+	if err != nil || pid <= 0 {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid project id",
+		}, 400)
+		return
+	}
+
+	req := &GetTasksRequest{}
+	err = json.Unmarshal(r.Ctx.Request.Body(), req)
+	if err != nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Could not parse request",
+		}, 400)
+		return
+	}
+
+	if !req.IsValid() {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid request",
+		}, 400)
+		return
+	}
+
+	sess, _ := api.Session.Get(r.Ctx)
+	manager := sess.Get("manager")
+
+	if !isActionOnProjectAuthorized(pid, manager, storage.RoleRead, api.Database) {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Unauthorized",
+		}, 403)
+		return
+	}
+
+	tasks := api.Database.GetTasks(pid, &req.Filter, req.After, req.Count)
+	if tasks == nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Could not get tasks, see server logs",
+		}, 500)
+		return
+	}
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+		Content: GetTasksResponse{
+			Tasks: tasks,
+		},
+	})
+}
+
+func (api *WebAPI) GetTaskDetails(r *Request) {
+
+	pid, err := strconv.ParseInt(r.Ctx.UserValue("id").(string), 10, 64)
+	if err != nil || pid <= 0 {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid project id",
+		}, 400)
+		return
+	}
+
+	tid, err := strconv.ParseInt(r.Ctx.UserValue("task").(string), 10, 64)
+	if err != nil || tid <= 0 {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid task id",
+		}, 400)
+		return
+	}
+
+	sess, _ := api.Session.Get(r.Ctx)
+	manager := sess.Get("manager")
+
+	if !isActionOnProjectAuthorized(pid, manager, storage.RoleRead, api.Database) {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Unauthorized",
+		}, 403)
+		return
+	}
+
+	details := api.Database.GetTaskDetails(pid, tid)
+	if details == nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Task not found",
+		}, 404)
+		return
+	}
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+		Content: GetTaskDetailsResponse{
+			Details: details,
+		},
+	})
+}
+
+// Parses a request that either targets the task in the url or
+// all the tasks matching the filter in the body
+func (api *WebAPI) parseEditTasksRequest(r *Request) (int64, *EditTasksRequest, bool) {
+
+	pid, err := strconv.ParseInt(r.Ctx.UserValue("id").(string), 10, 64)
+	if err != nil || pid <= 0 {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid project id",
+		}, 400)
+		return 0, nil, false
+	}
+
+	req := &EditTasksRequest{}
+	if len(r.Ctx.Request.Body()) != 0 {
+		err = json.Unmarshal(r.Ctx.Request.Body(), req)
+		if err != nil {
+			r.Json(JsonResponse{
+				Ok:      false,
+				Message: "Could not parse request",
+			}, 400)
+			return 0, nil, false
+		}
+	}
+
+	if tidValue := r.Ctx.UserValue("task"); tidValue != nil {
+		tid, err := strconv.ParseInt(tidValue.(string), 10, 64)
+		if err != nil || tid <= 0 {
+			r.Json(JsonResponse{
+				Ok:      false,
+				Message: "Invalid task id",
+			}, 400)
+			return 0, nil, false
+		}
+		req.Filter = storage.TaskFilter{Id: tid}
+	}
+
+	if !req.IsValid() {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid request",
+		}, 400)
+		return 0, nil, false
+	}
+
+	if isTaskFilterEmpty(&req.Filter) {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Empty filter",
+		}, 400)
+		return 0, nil, false
+	}
+
+	sess, _ := api.Session.Get(r.Ctx)
+	manager := sess.Get("manager")
+
+	if !isActionOnProjectAuthorized(pid, manager, storage.RoleMaintenance, api.Database) {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Unauthorized",
+		}, 403)
+		return 0, nil, false
+	}
+
+	return pid, req, true
+}
+
+func (api *WebAPI) DeleteTasks(r *Request) {
+
+	pid, req, ok := api.parseEditTasksRequest(r)
+	if !ok {
+		return
+	}
+
+	res := api.Database.DeleteTasks(pid, &req.Filter)
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+		Content: EditTasksResponse{
+			AffectedTasks: res,
+		},
+	})
+}
+
+func (api *WebAPI) UpdateTasks(r *Request) {
+
+	pid, req, ok := api.parseEditTasksRequest(r)
+	if !ok {
+		return
+	}
+
+	res := api.Database.UpdateTasks(pid, &req.Filter, req.Priority, req.MaxRetries)
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+		Content: EditTasksResponse{
+			AffectedTasks: res,
+		},
+	})
+}
+
+func (api *WebAPI) UnassignTasks(r *Request) {
+
+	pid, req, ok := api.parseEditTasksRequest(r)
+	if !ok {
+		return
+	}
+
+	res := api.Database.UnassignTasks(pid, &req.Filter)
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+		Content: EditTasksResponse{
+			AffectedTasks: res,
+		},
+	})
+}
+
+func (api *WebAPI) CancelTasks(r *Request) {
+
+	pid, req, ok := api.parseEditTasksRequest(r)
+	if !ok {
+		return
+	}
+
+	res := api.Database.CancelTasks(pid, &req.Filter)
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+		Content: EditTasksResponse{
+			AffectedTasks: res,
+		},
+	})
+}
+
+func (api *WebAPI) RequeueDisputedTasks(r *Request) {
+
+	pid, req, ok := api.parseEditTasksRequest(r)
+	if !ok {
+		return
+	}
+
+	res := api.Database.RequeueDisputedTasks(pid, &req.Filter)
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+		Content: EditTasksResponse{
+			AffectedTasks: res,
+		},
+	})
+}
+
+func (api *WebAPI) MoveTasks(r *Request) {
+
+	pid, req, ok := api.parseEditTasksRequest(r)
+	if !ok {
+		return
+	}
+
+	sess, _ := api.Session.Get(r.Ctx)
+	manager := sess.Get("manager")
+
+	if req.Project == 0 || api.Database.GetProject(req.Project) == nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Target project not found",
+		}, 400)
+		return
+	}
+
+	if !isActionOnProjectAuthorized(req.Project, manager, storage.RoleMaintenance, api.Database) {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Unauthorized",
+		}, 403)
+		return
+	}
+
+	res, err := api.Database.MoveTasks(pid, &req.Filter, req.Project)
+	if err != nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: err.Error(),
+		}, 409)
+		return
+	}
+
+	r.OkJson(JsonResponse{
+		Ok: true,
+		Content: EditTasksResponse{
+			AffectedTasks: res,
+		},
+	})
+}
@@ -88,7 +88,11 @@ func (api *WebAPI) GetWorker(r *Request) {
 					Id:      worker.Id,
 					Created: worker.Created,
 					Paused:  worker.Paused,
+					Tags:    worker.Tags,
 					Secret:  secret,
+
+					MaxConcurrentTasks: worker.MaxConcurrentTasks,
+					Reputation:         api.Database.GetWorkerReputation(worker.Id),
 				},
 			},
 		})
@@ -120,7 +124,17 @@ func (api *WebAPI) UpdateWorker(r *Request) {
 		}, 400)
 		return
 	}
+	if !req.isValid() {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid request",
+		}, 400)
+		return
+	}
 	worker.Alias = req.Alias
+	if req.Tags != nil {
+		worker.Tags = req.Tags
+	}
 
 	ok := api.Database.UpdateWorker(worker)
 
@@ -184,6 +198,54 @@ func (api *WebAPI) WorkerSetPaused(r *Request) {
 	}
 }
 
+func (api *WebAPI) WorkerSetMaxConcurrentTasks(r *Request) {
+
+	sess, _ := api.Session.Get(r.Ctx)
+	manager := sess.Get("manager")
+
+	if manager == nil || !manager.(*storage.Manager).WebsiteAdmin {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Unauthorized",
+		}, 403)
+		return
+	}
+
+	req := &WorkerSetMaxConcurrentTasksRequest{}
+	err := json.Unmarshal(r.Ctx.Request.Body(), req)
+	if err != nil || !req.isValid() {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Could not parse request",
+		}, 400)
+		return
+	}
+
+	worker := api.Database.GetWorker(req.Worker)
+	if worker == nil {
+		r.Json(JsonResponse{
+			Ok:      false,
+			Message: "Invalid worker",
+		}, 400)
+		return
+	}
+
+	worker.MaxConcurrentTasks = req.MaxConcurrentTasks
+
+	ok := api.Database.UpdateWorker(worker)
+
+	if ok {
+		r.OkJson(JsonResponse{
+			Ok: true,
+		})
+	} else {
+		r.OkJson(JsonResponse{
+			Ok:      false,
+			Message: "Could not update worker",
+		})
+	}
+}
+
 func (api *WebAPI) GetAllWorkerStats(r *Request) {
 	stats := api.Database.GetAllWorkerStats()
 
@@ -212,6 +274,7 @@ func (api *WebAPI) workerCreate(request *CreateWorkerRequest) (*storage.Worker,
 		Created: time.Now().Unix(),
 		Secret:  makeSecret(),
 		Alias:   request.Alias,
+		Tags:    request.Tags,
 	}
 
 	api.Database.SaveWorker(&worker)
@@ -114,6 +114,15 @@ func (c TaskTrackerClient) FetchTask(projectId int) (*AssignTaskResponse, error)
 	return &jsonResp, err
 }
 
+func (c TaskTrackerClient) FetchTasks(projectId int, n int) (*AssignTasksResponse, error) {
+
+	httpResp := c.get("/task/bulk_get/" + strconv.Itoa(projectId) + "?count=" + strconv.Itoa(n))
+	var jsonResp AssignTasksResponse
+	err := unmarshalResponse(httpResp, &jsonResp)
+
+	return &jsonResp, err
+}
+
 func (c TaskTrackerClient) ReleaseTask(req api.ReleaseTaskRequest) (*ReleaseTaskResponse, error) {
 
 	httpResp := c.post("/task/release", req)
@@ -123,6 +132,33 @@ func (c TaskTrackerClient) ReleaseTask(req api.ReleaseTaskRequest) (*ReleaseTask
 	return &jsonResp, err
 }
 
+func (c TaskTrackerClient) BulkReleaseTask(req api.BulkReleaseTaskRequest) (*BulkReleaseTaskResponse, error) {
+
+	httpResp := c.post("/task/bulk_release", req)
+	var jsonResp BulkReleaseTaskResponse
+	err := unmarshalResponse(httpResp, &jsonResp)
+
+	return &jsonResp, err
+}
+
+func (c TaskTrackerClient) TaskHeartbeat(req api.TaskHeartbeatRequest) (*TaskHeartbeatResponse, error) {
+
+	httpResp := c.post("/task/heartbeat", req)
+	var jsonResp TaskHeartbeatResponse
+	err := unmarshalResponse(httpResp, &jsonResp)
+
+	return &jsonResp, err
+}
+
+func (c TaskTrackerClient) ReportProgress(req api.TaskProgressRequest) (api.JsonResponse, error) {
+
+	httpResp := c.post("/task/progress", req)
+	var jsonResp api.JsonResponse
+	err := unmarshalResponse(httpResp, &jsonResp)
+
+	return jsonResp, err
+}
+
 func (c TaskTrackerClient) SubmitTask(req api.SubmitTaskRequest) (AssignTaskResponse, error) {
 
 	httpResp := c.post("/task/submit", req)
@@ -134,6 +170,16 @@ func (c TaskTrackerClient) SubmitTask(req api.SubmitTaskRequest) (AssignTaskResp
 	return jsonResp, err
 }
 
+// Results are in the same order as the requests, see api.SubmitStatus
+func (c TaskTrackerClient) BulkSubmitTasks(req api.BulkSubmitTaskRequest) (*BulkSubmitTaskResponse, error) {
+
+	httpResp := c.post("/task/bulk_submit", req)
+	var jsonResp BulkSubmitTaskResponse
+	err := unmarshalResponse(httpResp, &jsonResp)
+
+	return &jsonResp, err
+}
+
 func (c TaskTrackerClient) GetProjectSecret(projectId int) (string, error) {
 
 	httpResp := c.get("/project/secret/" + strconv.Itoa(projectId))
@@ -1,6 +1,9 @@
 package client
 
-import "github.com/simon987/task_tracker/storage"
+import (
+	"github.com/simon987/task_tracker/api"
+	"github.com/simon987/task_tracker/storage"
+)
 
 type Worker struct {
 	Id     int64  `json:"id"`
@@ -25,11 +28,46 @@ type AssignTaskResponse struct {
 	} `json:"content"`
 }
 
+type AssignTasksResponse struct {
+	Ok             bool    `json:"ok"`
+	Message        string  `json:"message"`
+	RateLimitDelay float64 `json:"rate_limit_delay,omitempty"`
+	Content        struct {
+		Tasks []storage.Task `json:"tasks"`
+	} `json:"content"`
+}
+
 type ReleaseTaskResponse struct {
 	Ok      bool   `json:"ok"`
 	Message string `json:"message"`
 	Content struct {
-		Updated bool `json:"updated"`
+		Updated  bool                       `json:"updated"`
+		Children []api.BulkSubmitTaskResult `json:"children"`
+	} `json:"content"`
+}
+
+type BulkReleaseTaskResponse struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+	Content struct {
+		Results []api.BulkReleaseTaskResult `json:"results"`
+	} `json:"content"`
+}
+
+type BulkSubmitTaskResponse struct {
+	Ok             bool    `json:"ok"`
+	Message        string  `json:"message"`
+	RateLimitDelay float64 `json:"rate_limit_delay,omitempty"`
+	Content        struct {
+		Results []api.BulkSubmitTaskResult `json:"results"`
+	} `json:"content"`
+}
+
+type TaskHeartbeatResponse struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+	Content struct {
+		LeaseRemaining int64 `json:"lease_remaining"`
 	} `json:"content"`
 }
 
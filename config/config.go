@@ -19,6 +19,13 @@ var Cfg struct {
 	MonitoringInterval         time.Duration
 	ResetTimedOutTasksInterval time.Duration
 	MonitoringHistory          time.Duration
+	ArchiveRetention           time.Duration
+
+	PurgeCompletedHashesInterval time.Duration
+	PurgeTaskArchiveInterval     time.Duration
+	PurgeTaskGroupsInterval      time.Duration
+	PurgeCompletedTasksInterval  time.Duration
+	CompletedTaskRetention       time.Duration
 }
 
 func SetupConfig() {
@@ -49,6 +56,18 @@ func SetupConfig() {
 	handleErr(err)
 	Cfg.MonitoringHistory, err = time.ParseDuration(viper.GetString("monitoring.history_length"))
 	handleErr(err)
+	Cfg.ArchiveRetention, err = time.ParseDuration(viper.GetString("monitoring.archive_retention"))
+	handleErr(err)
+	Cfg.PurgeCompletedHashesInterval, err = time.ParseDuration(viper.GetString("maintenance.purge_completed_hashes_interval"))
+	handleErr(err)
+	Cfg.PurgeTaskArchiveInterval, err = time.ParseDuration(viper.GetString("maintenance.purge_task_archive_interval"))
+	handleErr(err)
+	Cfg.PurgeTaskGroupsInterval, err = time.ParseDuration(viper.GetString("maintenance.purge_task_groups_interval"))
+	handleErr(err)
+	Cfg.PurgeCompletedTasksInterval, err = time.ParseDuration(viper.GetString("maintenance.purge_completed_tasks_interval"))
+	handleErr(err)
+	Cfg.CompletedTaskRetention, err = time.ParseDuration(viper.GetString("maintenance.completed_task_retention"))
+	handleErr(err)
 }
 
 func handleErr(err error) {
@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/simon987/task_tracker/config"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+// Tasks of projects with archive_tasks are moved to the task_archive table
+// when they are completed or hard reset. For hard reset tasks, CompletionTime
+// is the time of the reset and VerificationHash is not set
+type ArchivedTask struct {
+	Id               int64      `json:"id"`
+	Hash64           int64      `json:"hash64"`
+	Priority         int16      `json:"priority"`
+	Retries          int16      `json:"retries"`
+	MaxRetries       int16      `json:"max_retries"`
+	Status           TaskStatus `json:"status"`
+	Recipe           string     `json:"recipe"`
+	Assignee         int64      `json:"assignee"`
+	VerificationHash int64      `json:"verification_hash"`
+	CompletionTime   int64      `json:"completion_time"`
+}
+
+const archiveColumns = `id, project, hash64, priority, retries, max_retries, status, recipe,
+	assignee, verification_hash, completion_time`
+
+const archivePartitionPrefix = "task_archive_"
+const archivePartitionLayout = "20060102"
+
+func (database *Database) GetArchivedTasks(pid int64, after int64, count int) []ArchivedTask {
+
+	db := database.getDB()
+
+	rows, err := db.Query(`SELECT id, COALESCE(hash64, 0), COALESCE(priority, 0), COALESCE(retries, 0),
+		COALESCE(max_retries, 0), status, COALESCE(recipe, ''), COALESCE(assignee, 0),
+		COALESCE(verification_hash, 0), completion_time
+		FROM task_archive
+		WHERE project=$1 AND id>$2
+		ORDER BY id LIMIT $3`, pid, after, count)
+	handleErr(err)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	tasks := make([]ArchivedTask, 0)
+	for rows.Next() {
+		task := ArchivedTask{}
+
+		err := rows.Scan(&task.Id, &task.Hash64, &task.Priority, &task.Retries, &task.MaxRetries,
+			&task.Status, &task.Recipe, &task.Assignee, &task.VerificationHash, &task.CompletionTime)
+		handleErr(err)
+
+		tasks = append(tasks, task)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"project": pid,
+		"after":   after,
+		"count":   len(tasks),
+	}).Trace("Database.GetArchivedTasks")
+
+	return tasks
+}
+
+// Creates the daily partitions of task_archive for today and tomorrow, then
+// drops the partitions (and deletes the rows of the default partition) that
+// are older than the archive retention period. Days and the retention cutoff
+// follow the clock of the database, which sets completion_time
+func (database *Database) PurgeTaskArchive() {
+
+	db := database.getDB()
+
+	var today int64
+	err := db.QueryRow(`SELECT extract(epoch from date_trunc('day', now() at time zone 'utc'))::BIGINT`).
+		Scan(&today)
+	handleErr(err)
+	if err != nil {
+		return
+	}
+
+	for _, from := range []int64{today, today + secondsPerDay} {
+		err := createArchivePartition(db, from, from+secondsPerDay)
+		handleErr(err)
+	}
+
+	if config.Cfg.ArchiveRetention <= 0 {
+		return
+	}
+
+	var cutoff int64
+	err = db.QueryRow(`SELECT extract(epoch from now() at time zone 'utc')::BIGINT - $1`,
+		int64(config.Cfg.ArchiveRetention.Seconds())).Scan(&cutoff)
+	handleErr(err)
+	if err != nil {
+		return
+	}
+
+	partitions, err := getArchivePartitions(db)
+	if err != nil {
+		return
+	}
+
+	var dropped int64
+	for _, partition := range partitions {
+		day, err := time.Parse(archivePartitionLayout, strings.TrimPrefix(partition, archivePartitionPrefix))
+		if err != nil || day.Unix()+secondsPerDay > cutoff {
+			continue
+		}
+		_, err = db.Exec(`DROP TABLE ` + partition)
+		handleErr(err)
+		if err == nil {
+			dropped++
+		}
+	}
+
+	res, err := db.Exec(`DELETE FROM task_archive WHERE completion_time < $1`, cutoff)
+	handleErr(err)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+
+	logrus.WithFields(logrus.Fields{
+		"droppedPartitions": dropped,
+		"rowsAffected":      rowsAffected,
+	}).Info("Purged task archive")
+}
+
+const secondsPerDay = 24 * 60 * 60
+
+// Attaching a partition fails if the default partition has rows in its range,
+// so these rows are moved to the new partition first. The default partition
+// is locked so that concurrent purge jobs don't create the same partition
+func createArchivePartition(db *sql.DB, from int64, to int64) error {
+
+	partition := archivePartitionPrefix + time.Unix(from, 0).UTC().Format(archivePartitionLayout)
+
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = txn.Exec(`LOCK TABLE task_archive_default IN SHARE ROW EXCLUSIVE MODE`)
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+
+	var exists bool
+	err = txn.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, partition).Scan(&exists)
+	if err != nil || exists {
+		_ = txn.Rollback()
+		return err
+	}
+
+	_, err = txn.Exec(fmt.Sprintf(`CREATE TABLE %s (LIKE task_archive INCLUDING DEFAULTS INCLUDING CONSTRAINTS)`,
+		partition))
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+
+	res, err := txn.Exec(fmt.Sprintf(`WITH moved AS (
+			DELETE FROM task_archive_default WHERE completion_time >= $1 AND completion_time < $2 
+			RETURNING *
+		) INSERT INTO %s SELECT * FROM moved`, partition), from, to)
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+
+	_, err = txn.Exec(fmt.Sprintf(`ALTER TABLE task_archive ATTACH PARTITION %s FOR VALUES FROM (%d) TO (%d)`,
+		partition, from, to))
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+
+	err = txn.Commit()
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+
+	logrus.WithFields(logrus.Fields{
+		"partition":    partition,
+		"rowsAffected": rowsAffected,
+	}).Info("Created task archive partition")
+
+	return nil
+}
+
+func getArchivePartitions(db *sql.DB) ([]string, error) {
+
+	rows, err := db.Query(`SELECT c.relname FROM pg_inherits i
+		INNER JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'task_archive'::regclass`)
+	handleErr(err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partitions := make([]string, 0)
+	for rows.Next() {
+		var partition string
+		err := rows.Scan(&partition)
+		handleErr(err)
+		partitions = append(partitions, partition)
+	}
+	return partitions, nil
+}
@@ -22,6 +22,7 @@ type Database struct {
 	assignAccessCache map[int64]map[int64]bool
 
 	assignMutex *sync.Mutex
+	notifier    *taskNotifier
 }
 
 func New() *Database {
@@ -32,8 +33,13 @@ func New() *Database {
 	d.assignAccessCache = make(map[int64]map[int64]bool)
 	d.submitAccessCache = make(map[int64]map[int64]bool)
 	d.assignMutex = &sync.Mutex{}
+	d.notifier = newTaskNotifier()
 
 	d.init()
+	err := d.listen()
+	if err != nil {
+		logrus.WithError(err).Fatal("Could not listen for task notifications")
+	}
 
 	return &d
 }
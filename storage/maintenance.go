@@ -1,6 +1,10 @@
 package storage
 
 import (
+	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/simon987/task_tracker/config"
 	"github.com/sirupsen/logrus"
 )
 
@@ -8,7 +12,7 @@ func (database *Database) ResetFailedTasks(pid int64) int64 {
 
 	db := database.getDB()
 
-	res, err := db.Exec(`UPDATE task SET status=1, retries=0, assign_time=NULL, assignee=NULL 
+	res, err := db.Exec(`UPDATE task SET status=1, retries=0, retry_after=0, assign_time=NULL, assignee=NULL 
 		WHERE project=$1 AND status=2`, pid)
 	handleErr(err)
 
@@ -22,7 +26,7 @@ func (database *Database) ResetTimedOutTasks() {
 
 	res, err := db.Exec(`
 		UPDATE task SET assignee=NULL, assign_time=NULL
-		WHERE status=1 AND assignee IS NOT NULL
+		WHERE status=4
 		AND extract(epoch from now() at time zone 'utc') > (assign_time + max_assign_time);`)
 	handleErr(err)
 	if err != nil {
@@ -36,13 +40,48 @@ func (database *Database) ResetTimedOutTasks() {
 	}).Info("Reset timed out tasks")
 }
 
+// Tasks of projects with archive_tasks are archived before being deleted.
+// Tasks are unassigned first so that they are not counted as closed
 func (database Database) HardReset(pid int64) int64 {
 
 	db := database.getDB()
 
-	_, err := db.Exec(`UPDATE task SET assignee=NULL WHERE project=$1`, pid)
+	txn, err := db.Begin()
 	handleErr(err)
-	res, err := db.Exec(`DELETE FROM task WHERE project=$1`, pid)
+	if err != nil {
+		return 0
+	}
+
+	_, err = txn.Exec(`INSERT INTO task_archive (`+archiveColumns+`)
+		SELECT task.id, task.project, task.hash64, task.priority, task.retries, task.max_retries,
+		       task.status, task.recipe, task.assignee, NULL, extract(epoch from now() at time zone 'utc')
+		FROM task INNER JOIN project ON project.id = task.project
+		WHERE task.project=$1 AND project.archive_tasks`, pid)
+	handleErr(err)
+	if err != nil {
+		_ = txn.Rollback()
+		return 0
+	}
+
+	_, err = txn.Exec(`UPDATE task SET assignee=NULL WHERE project=$1`, pid)
+	handleErr(err)
+	if err != nil {
+		_ = txn.Rollback()
+		return 0
+	}
+
+	res, err := txn.Exec(`DELETE FROM task WHERE project=$1`, pid)
+	handleErr(err)
+	if err != nil {
+		_ = txn.Rollback()
+		return 0
+	}
+
+	err = txn.Commit()
+	handleErr(err)
+	if err != nil {
+		return 0
+	}
 
 	rowsAffected, _ := res.RowsAffected()
 
@@ -59,7 +98,7 @@ func (database Database) ReclaimAssignedTasks(pid int64) int64 {
 	db := database.getDB()
 
 	res, err := db.Exec(`UPDATE task SET assignee=NULL, assign_time=NULL 
-		WHERE project=$1 AND status=1`, pid)
+		WHERE project=$1 AND status=4`, pid)
 	handleErr(err)
 
 	rowsAffected, _ := res.RowsAffected()
@@ -71,3 +110,343 @@ func (database Database) ReclaimAssignedTasks(pid int64) int64 {
 
 	return rowsAffected
 }
+
+// Returns up to count failed tasks with an id greater than after,
+// along with the last attempt made on each of them
+func (database *Database) GetFailedTasks(pid int64, after int64, count int) []FailedTask {
+
+	db := database.getDB()
+
+	rows, err := db.Query(`SELECT task.id, task.priority, task.retries, task.max_retries, task.recipe,
+		ta.worker, ta.result, ta.message, ta.details, ta.timestamp
+		FROM task
+		LEFT JOIN LATERAL (
+			SELECT worker, result, message, details, timestamp FROM task_attempt
+			WHERE task_attempt.task=task.id
+			ORDER BY task_attempt.id DESC LIMIT 1
+		) ta ON TRUE
+		WHERE task.project=$1 AND task.status=2 AND task.id>$2
+		ORDER BY task.id LIMIT $3`, pid, after, count)
+	handleErr(err)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	tasks := make([]FailedTask, 0)
+	for rows.Next() {
+		task := FailedTask{}
+		var worker, result, timestamp sql.NullInt64
+		var message, details sql.NullString
+
+		err := rows.Scan(&task.Id, &task.Priority, &task.Retries, &task.MaxRetries, &task.Recipe,
+			&worker, &result, &message, &details, &timestamp)
+		handleErr(err)
+
+		if timestamp.Valid {
+			task.LastAttempt = &TaskAttempt{
+				Worker:    worker.Int64,
+				Result:    TaskResult(result.Int64),
+				Message:   message.String,
+				Timestamp: timestamp.Int64,
+			}
+			if details.Valid {
+				task.LastAttempt.Details = json.RawMessage(details.String)
+			}
+		}
+		tasks = append(tasks, task)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"project": pid,
+		"after":   after,
+		"count":   len(tasks),
+	}).Trace("Database.GetFailedTasks")
+
+	return tasks
+}
+
+// Deletes the completed hashes that are past the dedup_ttl of their
+// project, or whose project no longer deduplicates tasks
+func (database *Database) PurgeCompletedHashes() {
+
+	db := database.getDB()
+
+	res, err := db.Exec(`
+		DELETE FROM completed_hash ch
+		USING project
+		WHERE project.id = ch.project 
+		AND NOT ` + completedHashCondition)
+	handleErr(err)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+
+	logrus.WithFields(logrus.Fields{
+		"rowsAffected": rowsAffected,
+	}).Info("Purged completed hashes")
+}
+
+// Deletes the task_group rows of the groups that no longer have tasks. The
+// table is locked so that a task inserted in the meantime keeps its group
+func (database *Database) PurgeTaskGroups() {
+
+	db := database.getDB()
+
+	txn, err := db.Begin()
+	handleErr(err)
+	if err != nil {
+		return
+	}
+
+	_, err = txn.Exec(`LOCK TABLE task_group IN SHARE ROW EXCLUSIVE MODE`)
+	handleErr(err)
+	if err != nil {
+		_ = txn.Rollback()
+		return
+	}
+
+	res, err := txn.Exec(`
+		DELETE FROM task_group tg
+		WHERE NOT EXISTS(SELECT 1 FROM task WHERE task.project = tg.project AND task.group_key = tg.group_key)`)
+	handleErr(err)
+	if err != nil {
+		_ = txn.Rollback()
+		return
+	}
+
+	err = txn.Commit()
+	handleErr(err)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+
+	logrus.WithFields(logrus.Fields{
+		"rowsAffected": rowsAffected,
+	}).Info("Purged task groups")
+}
+
+// Deletes the COMPLETED tasks (kept by keep_completed_tasks) that
+// are older than the completed task retention period
+func (database *Database) PurgeCompletedTasks() {
+
+	if config.Cfg.CompletedTaskRetention <= 0 {
+		return
+	}
+
+	db := database.getDB()
+
+	res, err := db.Exec(`DELETE FROM task WHERE status=6 
+		AND completion_time < extract(epoch from now() at time zone 'utc') - $1`,
+		int64(config.Cfg.CompletedTaskRetention.Seconds()))
+	handleErr(err)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+
+	logrus.WithFields(logrus.Fields{
+		"rowsAffected": rowsAffected,
+	}).Info("Purged completed tasks")
+}
+
+// Tasks are unassigned before being deleted so that
+// they are not counted as closed
+func (database *Database) DeleteTasks(pid int64, filter *TaskFilter) int64 {
+
+	db := database.getDB()
+
+	txn, err := db.Begin()
+	handleErr(err)
+	if err != nil {
+		return 0
+	}
+
+	rows, err := txn.Query(`UPDATE task SET assignee=NULL WHERE `+taskFilterCondition+`
+		RETURNING task.id`, filter.args(pid)...)
+	handleErr(err)
+	if err != nil {
+		_ = txn.Rollback()
+		return 0
+	}
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		handleErr(err)
+		ids = append(ids, id)
+	}
+	_ = rows.Close()
+
+	res, err := txn.Exec(`DELETE FROM task WHERE id = ANY($1)`, pq.Array(ids))
+	handleErr(err)
+	if err != nil {
+		_ = txn.Rollback()
+		return 0
+	}
+
+	err = txn.Commit()
+	handleErr(err)
+	if err != nil {
+		return 0
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+
+	logrus.WithFields(logrus.Fields{
+		"rowsAffected": rowsAffected,
+		"project":      pid,
+		"filter":       filter,
+	}).Info("Delete tasks")
+
+	return rowsAffected
+}
+
+// nil values are left untouched
+func (database *Database) UpdateTasks(pid int64, filter *TaskFilter, priority *int16, maxRetries *int16) int64 {
+
+	db := database.getDB()
+
+	args := append(filter.args(pid), priority, maxRetries)
+	res, err := db.Exec(`UPDATE task SET priority=COALESCE($10, priority), 
+		max_retries=COALESCE($11, max_retries) WHERE `+taskFilterCondition, args...)
+	handleErr(err)
+	if err != nil {
+		return 0
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+
+	logrus.WithFields(logrus.Fields{
+		"rowsAffected": rowsAffected,
+		"project":      pid,
+		"filter":       filter,
+	}).Info("Update tasks")
+
+	return rowsAffected
+}
+
+func (database *Database) UnassignTasks(pid int64, filter *TaskFilter) int64 {
+
+	db := database.getDB()
+
+	res, err := db.Exec(`UPDATE task SET assignee=NULL, assign_time=NULL 
+		WHERE assignee IS NOT NULL AND `+taskFilterCondition, filter.args(pid)...)
+	handleErr(err)
+	if err != nil {
+		return 0
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+
+	logrus.WithFields(logrus.Fields{
+		"rowsAffected": rowsAffected,
+		"project":      pid,
+		"filter":       filter,
+	}).Info("Unassign tasks")
+
+	return rowsAffected
+}
+
+// Disputed tasks go back to NEW, the verification votes are
+// deleted so that every worker can verify them again
+func (database *Database) RequeueDisputedTasks(pid int64, filter *TaskFilter) int64 {
+
+	db := database.getDB()
+
+	txn, err := db.Begin()
+	handleErr(err)
+	if err != nil {
+		return 0
+	}
+
+	_, err = txn.Exec(`DELETE FROM worker_verifies_task wvt USING task 
+		WHERE wvt.task = task.id AND task.status=3 AND `+taskFilterCondition, filter.args(pid)...)
+	handleErr(err)
+	if err != nil {
+		_ = txn.Rollback()
+		return 0
+	}
+
+	res, err := txn.Exec(`UPDATE task SET status=1 WHERE task.status=3 AND `+taskFilterCondition,
+		filter.args(pid)...)
+	handleErr(err)
+	if err != nil {
+		_ = txn.Rollback()
+		return 0
+	}
+
+	err = txn.Commit()
+	handleErr(err)
+	if err != nil {
+		return 0
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+
+	logrus.WithFields(logrus.Fields{
+		"rowsAffected": rowsAffected,
+		"project":      pid,
+		"filter":       filter,
+	}).Info("Requeue disputed tasks")
+
+	return rowsAffected
+}
+
+// Completed and cancelled tasks are left untouched
+func (database *Database) CancelTasks(pid int64, filter *TaskFilter) int64 {
+
+	db := database.getDB()
+
+	res, err := db.Exec(`UPDATE task SET status=7, assignee=NULL, assign_time=NULL 
+		WHERE task.status NOT IN (6,7) AND `+taskFilterCondition, filter.args(pid)...)
+	handleErr(err)
+	if err != nil {
+		return 0
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+
+	logrus.WithFields(logrus.Fields{
+		"rowsAffected": rowsAffected,
+		"project":      pid,
+		"filter":       filter,
+	}).Info("Cancel tasks")
+
+	return rowsAffected
+}
+
+// Moved tasks are unassigned. Fails if a task with the same
+// hash already exists in the target project
+func (database *Database) MoveTasks(pid int64, filter *TaskFilter, target int64) (int64, error) {
+
+	db := database.getDB()
+
+	args := append(filter.args(pid), target)
+	res, err := db.Exec(`UPDATE task SET project=$10, assignee=NULL, assign_time=NULL 
+		WHERE `+taskFilterCondition, args...)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"project": pid,
+			"target":  target,
+		}).Warn("Database.MoveTasks UPDATE task ERROR")
+		return 0, err
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+
+	logrus.WithFields(logrus.Fields{
+		"rowsAffected": rowsAffected,
+		"project":      pid,
+		"target":       target,
+		"filter":       filter,
+	}).Info("Move tasks")
+
+	return rowsAffected, nil
+}
@@ -12,9 +12,29 @@ type ProjectMonitoringSnapshot struct {
 	ClosedTaskCount           int64 `json:"closed_task_count"`
 	WorkerAccessCount         int64 `json:"worker_access_count"`
 	AwaitingVerificationCount int64 `json:"awaiting_verification_count"`
+	ScheduledTaskCount        int64 `json:"scheduled_task_count"`
+	RetryingTaskCount         int64 `json:"retrying_task_count"`
+	AssignedTaskCount         int64 `json:"assigned_task_count"`
+	CompletedTaskCount        int64 `json:"completed_task_count"`
+	DisputedTaskCount         int64 `json:"disputed_task_count"`
+	CancelledTaskCount        int64 `json:"cancelled_task_count"`
 	TimeStamp                 int64 `json:"time_stamp"`
 }
 
+const snapshotColumns = `new_task_count, failed_task_count, closed_task_count,
+	worker_access_count, awaiting_verification_task_count, scheduled_task_count, retrying_task_count,
+	assigned_task_count, completed_task_count, disputed_task_count, cancelled_task_count, timestamp`
+
+func scanSnapshot(row scanner) (ProjectMonitoringSnapshot, error) {
+
+	s := ProjectMonitoringSnapshot{}
+	err := row.Scan(&s.NewTaskCount, &s.FailedTaskCount, &s.ClosedTaskCount, &s.WorkerAccessCount,
+		&s.AwaitingVerificationCount, &s.ScheduledTaskCount, &s.RetryingTaskCount, &s.AssignedTaskCount, &s.CompletedTaskCount,
+		&s.DisputedTaskCount, &s.CancelledTaskCount, &s.TimeStamp)
+
+	return s, err
+}
+
 func (database *Database) MakeProjectSnapshots() {
 
 	startTime := time.Now()
@@ -23,18 +43,39 @@ func (database *Database) MakeProjectSnapshots() {
 	insertRes, err := db.Exec(`
 		INSERT INTO project_monitoring_snapshot
 		  (project, new_task_count, failed_task_count, closed_task_count, worker_access_count,
-		   awaiting_verification_task_count, timestamp)
+		   awaiting_verification_task_count, scheduled_task_count, retrying_task_count, assigned_task_count,
+		   completed_task_count, disputed_task_count, cancelled_task_count, timestamp)
 		SELECT id,
-			   (SELECT COUNT(*) FROM task 
-					LEFT JOIN worker_verifies_task wvt on task.id = wvt.task
-			   		WHERE task.project = project.id AND status = 1 AND wvt.task IS NULL),
-			   (SELECT COUNT(*) FROM task WHERE task.project = project.id AND status = 2),
+			   COALESCE(c.new, 0),
+			   COALESCE(c.failed, 0),
 			   closed_task_count,
 			   (SELECT COUNT(*) FROM worker_access wa WHERE wa.project = project.id),
-			   (SELECT COUNT(*) FROM worker_verifies_task INNER JOIN task t on worker_verifies_task.task = t.id
-			  		WHERE t.project = project.id),
+			   COALESCE(c.awaiting_verification, 0),
+			   COALESCE(c.scheduled, 0),
+			   COALESCE(c.retrying, 0),
+			   COALESCE(c.assigned, 0),
+			   COALESCE(c.completed, 0),
+			   COALESCE(c.disputed, 0),
+			   COALESCE(c.cancelled, 0),
 			   extract(epoch from now() at time zone 'utc')
-		FROM project`)
+		FROM project
+		LEFT JOIN (
+			SELECT task.project,
+				COUNT(*) FILTER (WHERE status = 1 AND GREATEST(task.not_before, task.retry_after)
+					<= extract(epoch from now() at time zone 'utc')) AS new,
+				COUNT(*) FILTER (WHERE status = 1 
+					AND task.not_before > extract(epoch from now() at time zone 'utc')) AS scheduled,
+				COUNT(*) FILTER (WHERE status = 1
+					AND task.retry_after > extract(epoch from now() at time zone 'utc')
+					AND task.not_before <= extract(epoch from now() at time zone 'utc')) AS retrying,
+				COUNT(*) FILTER (WHERE status = 2) AS failed,
+				COUNT(*) FILTER (WHERE status = 3) AS disputed,
+				COUNT(*) FILTER (WHERE status = 4) AS assigned,
+				COUNT(*) FILTER (WHERE status = 5) AS awaiting_verification,
+				COUNT(*) FILTER (WHERE status = 6) AS completed,
+				COUNT(*) FILTER (WHERE status = 7) AS cancelled
+			FROM task GROUP BY task.project
+		) c ON c.project = project.id`)
 	handleErr(err)
 	if err != nil {
 		return
@@ -62,8 +103,7 @@ func (database *Database) GetMonitoringSnapshotsBetween(pid int64, from int, to
 
 	snapshots := make([]ProjectMonitoringSnapshot, 0)
 
-	rows, err := db.Query(`SELECT new_task_count, failed_task_count, closed_task_count,
-		worker_access_count, awaiting_verification_task_count, timestamp FROM project_monitoring_snapshot 
+	rows, err := db.Query(`SELECT `+snapshotColumns+` FROM project_monitoring_snapshot 
 		WHERE project=$1 AND timestamp BETWEEN $2 AND $3 ORDER BY TIMESTAMP DESC `, pid, from, to)
 	handleErr(err)
 	if err != nil {
@@ -71,10 +111,7 @@ func (database *Database) GetMonitoringSnapshotsBetween(pid int64, from int, to
 	}
 
 	for rows.Next() {
-
-		s := ProjectMonitoringSnapshot{}
-		err := rows.Scan(&s.NewTaskCount, &s.FailedTaskCount, &s.ClosedTaskCount, &s.WorkerAccessCount,
-			&s.AwaitingVerificationCount, &s.TimeStamp)
+		s, err := scanSnapshot(rows)
 		handleErr(err)
 
 		snapshots = append(snapshots, s)
@@ -96,8 +133,7 @@ func (database *Database) GetNMonitoringSnapshots(pid int64, count int) (ss *[]P
 
 	snapshots := make([]ProjectMonitoringSnapshot, 0)
 
-	rows, err := db.Query(`SELECT new_task_count, failed_task_count, closed_task_count,
-		worker_access_count, awaiting_verification_task_count, timestamp FROM project_monitoring_snapshot 
+	rows, err := db.Query(`SELECT `+snapshotColumns+` FROM project_monitoring_snapshot 
 		WHERE project=$1 ORDER BY TIMESTAMP DESC LIMIT $2`, pid, count)
 	handleErr(err)
 	if err != nil {
@@ -105,9 +141,7 @@ func (database *Database) GetNMonitoringSnapshots(pid int64, count int) (ss *[]P
 	}
 
 	for rows.Next() {
-		s := ProjectMonitoringSnapshot{}
-		err := rows.Scan(&s.NewTaskCount, &s.FailedTaskCount, &s.ClosedTaskCount, &s.WorkerAccessCount,
-			&s.AwaitingVerificationCount, &s.TimeStamp)
+		s, err := scanSnapshot(rows)
 		handleErr(err)
 
 		snapshots = append(snapshots, s)
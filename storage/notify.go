@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"github.com/lib/pq"
+	"github.com/simon987/task_tracker/config"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const taskAvailableChannel = "task_available"
+
+// Upper bound on the time between two checks for scheduled tasks
+const maxScheduledWakeup = time.Minute
+
+// Wakes up the requests waiting for a task. Notifications are received
+// through postgres LISTEN/NOTIFY so that submits/releases made through
+// other tracker instances also wake up waiting workers.
+type taskNotifier struct {
+	mu      sync.Mutex
+	waiters map[int64]chan struct{}
+
+	// Database time of the next check for scheduled tasks, signaled
+	// when a notification carries an earlier not_before
+	wakeup      int64
+	rescheduled chan struct{}
+}
+
+func newTaskNotifier() *taskNotifier {
+	return &taskNotifier{
+		waiters:     make(map[int64]chan struct{}),
+		rescheduled: make(chan struct{}, 1),
+	}
+}
+
+func (n *taskNotifier) wait(project int64) <-chan struct{} {
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ch, ok := n.waiters[project]
+	if !ok {
+		ch = make(chan struct{})
+		n.waiters[project] = ch
+	}
+	return ch
+}
+
+func (n *taskNotifier) notify(project int64) {
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ch, ok := n.waiters[project]
+	if ok {
+		close(ch)
+		delete(n.waiters, project)
+	}
+}
+
+func (n *taskNotifier) setWakeup(wakeup int64) {
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.wakeup = wakeup
+}
+
+func (n *taskNotifier) schedule(notBefore int64) {
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if notBefore < n.wakeup {
+		n.wakeup = notBefore
+		n.reschedule()
+	}
+}
+
+func (n *taskNotifier) reschedule() {
+	select {
+	case n.rescheduled <- struct{}{}:
+	default:
+	}
+}
+
+func (n *taskNotifier) notifyAll() {
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for project, ch := range n.waiters {
+		close(ch)
+		delete(n.waiters, project)
+	}
+}
+
+func (database *Database) listen() error {
+
+	listener := pq.NewListener(config.Cfg.DbConnStr, time.Second, time.Minute,
+		func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{
+					"event": event,
+				}).Warn("Database listener event")
+			}
+		})
+
+	err := listener.Listen(taskAvailableChannel)
+	handleErr(err)
+	if err != nil {
+		_ = listener.Close()
+		return err
+	}
+
+	go func() {
+		for notification := range listener.Notify {
+
+			// Notifications may have been lost during a reconnection
+			if notification == nil {
+				database.notifier.reschedule()
+				database.notifier.notifyAll()
+				continue
+			}
+
+			// Payload is "<project>" or "<project>,<not_before>"
+			fields := strings.Split(notification.Extra, ",")
+			project, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			if len(fields) == 2 {
+				notBefore, err := strconv.ParseInt(fields[1], 10, 64)
+				if err == nil {
+					database.notifier.schedule(notBefore)
+				}
+			}
+			database.notifier.notify(project)
+		}
+	}()
+
+	go database.wakeScheduled()
+
+	return nil
+}
+
+// Tasks with a not_before (or a retry_after) in the future don't trigger a
+// notification when they become available, so the waiters of their project
+// are woken up when the earliest not_before is reached. The timer is only
+// moved by notifications carrying an earlier not_before
+func (database *Database) wakeScheduled() {
+
+	last, _, err := database.getNextScheduledTask()
+	for err != nil {
+		time.Sleep(time.Second)
+		last, _, err = database.getNextScheduledTask()
+	}
+
+	for {
+		now, next, err := database.getNextScheduledTask()
+		if err == nil {
+			database.notifyScheduled(last, now)
+			last = now
+		}
+
+		sleep := maxScheduledWakeup
+		if err == nil && next != 0 && time.Duration(next-now)*time.Second < sleep {
+			sleep = time.Duration(next-now) * time.Second
+		}
+		if err == nil {
+			database.notifier.setWakeup(now + int64(sleep/time.Second))
+		}
+
+		timer := time.NewTimer(sleep)
+		select {
+		case <-timer.C:
+		case <-database.notifier.rescheduled:
+			timer.Stop()
+		}
+	}
+}
+
+// Returns the current database time and the earliest not_before
+// in the future of an available task (0 if there is none)
+func (database *Database) getNextScheduledTask() (int64, int64, error) {
+
+	db := database.getDB()
+
+	var now int64
+	var next int64
+	row := db.QueryRow(`SELECT n.now, COALESCE((SELECT MIN(GREATEST(not_before, retry_after)) FROM task
+			WHERE assignee IS NULL AND status IN (1,5) AND GREATEST(not_before, retry_after) > n.now), 0)
+		FROM (SELECT floor(extract(epoch from now() at time zone 'utc'))::BIGINT AS now) n`)
+	err := row.Scan(&now, &next)
+	handleErr(err)
+
+	return now, next, err
+}
+
+// Wakes up the waiters of the projects that have tasks
+// which became available between after (exclusive) and until
+func (database *Database) notifyScheduled(after int64, until int64) {
+
+	if until <= after {
+		return
+	}
+
+	db := database.getDB()
+
+	rows, err := db.Query(`SELECT DISTINCT project FROM task
+		WHERE assignee IS NULL AND status IN (1,5)
+		AND GREATEST(not_before, retry_after) > $1 AND GREATEST(not_before, retry_after) <= $2`,
+		after, until)
+	handleErr(err)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var project int64
+		err := rows.Scan(&project)
+		handleErr(err)
+		database.notifier.notify(project)
+	}
+}
+
+// Same as GetTasksFromProject, but waits up to timeout for a
+// task to become available if the project is empty
+func (database *Database) GetTasksFromProjectWait(worker *Worker, projectId int64,
+	count int, timeout time.Duration) []Task {
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		available := database.notifier.wait(projectId)
+
+		tasks := database.GetTasksFromProject(worker, projectId, count)
+		if len(tasks) != 0 {
+			return tasks
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return tasks
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-available:
+			timer.Stop()
+		case <-timer.C:
+			return tasks
+		}
+	}
+}
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/time/rate"
 	"strings"
@@ -21,6 +23,61 @@ type Project struct {
 	Paused     bool       `json:"paused"`
 	AssignRate rate.Limit `json:"assign_rate"`
 	SubmitRate rate.Limit `json:"submit_rate"`
+
+	RetryDelay      int64   `json:"retry_delay"`
+	RetryMultiplier float64 `json:"retry_multiplier"`
+	RetryMaxDelay   int64   `json:"retry_max_delay"`
+
+	Chains         []ProjectChain `json:"chains"`
+	AssignStrategy AssignStrategy `json:"assign_strategy"`
+
+	// Assigned tasks of the same group, 0 for no limit
+	MaxInFlightPerGroup int64 `json:"max_in_flight_per_group"`
+
+	// Used for the workers that don't have their own max_concurrent_tasks, 0 for no limit
+	DefaultMaxConcurrentTasks int64 `json:"default_max_concurrent_tasks"`
+
+	DedupMode DedupMode `json:"dedup_mode"`
+	// Seconds during which the hash of a completed task is remembered with DEDUP_TTL
+	DedupTtl int64 `json:"dedup_ttl"`
+
+	// Verifications after which a task that did not reach its verification_count
+	// is marked as DISPUTED, 0 for no limit
+	MaxVerificationAttempts int64 `json:"max_verification_attempts"`
+
+	// Workers below this reputation can't get tasks from the project
+	MinReputation float64 `json:"min_reputation"`
+	// Workers with at least trusted_reputation close tasks after
+	// trusted_verification_count matching verifications
+	TrustedReputation        float64 `json:"trusted_reputation"`
+	TrustedVerificationCount int16   `json:"trusted_verification_count"`
+
+	// Completed tasks are kept with the COMPLETED status instead of being deleted
+	KeepCompletedTasks bool `json:"keep_completed_tasks"`
+	// Completed and hard-reset tasks are moved to task_archive
+	ArchiveTasks bool `json:"archive_tasks"`
+
+	// JSON Schema that the recipes of submitted tasks must match, if not empty
+	RecipeSchema string `json:"recipe_schema"`
+}
+
+type DedupMode int
+
+const (
+	DEDUP_NONE    DedupMode = 0
+	DEDUP_TTL     DedupMode = 1
+	DEDUP_FOREVER DedupMode = 2
+)
+
+// Closed tasks are copied to Target. Priority overrides the priority of
+// the task if set. The recipe is either projected on Fields (top-level keys
+// of a JSON recipe), or rendered with Template, where {{key}} is replaced
+// by the value of key in the recipe
+type ProjectChain struct {
+	Target   int64    `json:"target"`
+	Priority *int16   `json:"priority"`
+	Fields   []string `json:"fields"`
+	Template string   `json:"template"`
 }
 
 type AssignedTasks struct {
@@ -28,18 +85,54 @@ type AssignedTasks struct {
 	TaskCount int64  `json:"task_count"`
 }
 
+const projectColumns = `id, priority, name, clone_url, git_repo, version, motd, public, hidden,
+	COALESCE(chain, 0), paused, assign_rate, submit_rate, retry_delay, retry_multiplier, retry_max_delay,
+	assign_strategy, max_in_flight_per_group, default_max_concurrent_tasks,
+	dedup_mode, dedup_ttl, max_verification_attempts, min_reputation, trusted_reputation,
+	trusted_verification_count, keep_completed_tasks, archive_tasks, recipe_schema,
+	COALESCE((SELECT json_agg(json_build_object('target', pc.target, 'priority', pc.priority,
+		'fields', pc.fields, 'template', pc.template) ORDER BY pc.target)
+		FROM project_chain pc WHERE pc.project = project.id), '[]')`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
 func (database *Database) SaveProject(project *Project, webhookSecret string) (int64, error) {
 	db := database.getDB()
 
-	row := db.QueryRow(`INSERT INTO project (name, git_repo, clone_url, version, priority,
-                     motd, public, hidden, chain, paused, webhook_secret, assign_rate, submit_rate)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,NULLIF($9, 0),$10,$11,$12,$13) RETURNING id`,
+	txn, err := db.Begin()
+	if err != nil {
+		return -1, err
+	}
+
+	row := txn.QueryRow(`INSERT INTO project (name, git_repo, clone_url, version, priority,
+                     motd, public, hidden, chain, paused, webhook_secret, assign_rate, submit_rate,
+                     retry_delay, retry_multiplier, retry_max_delay, assign_strategy, max_in_flight_per_group,
+                     default_max_concurrent_tasks, dedup_mode, dedup_ttl, max_verification_attempts,
+                     min_reputation, trusted_reputation, trusted_verification_count, keep_completed_tasks,
+                     archive_tasks, recipe_schema)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,NULLIF($9, 0),$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,
+		        $23,$24,$25,$26,$27,$28)
+		RETURNING id`,
 		project.Name, project.GitRepo, project.CloneUrl, project.Version, project.Priority, project.Motd,
 		project.Public, project.Hidden, project.Chain, project.Paused, webhookSecret, project.AssignRate,
-		project.SubmitRate)
+		project.SubmitRate, project.RetryDelay, project.RetryMultiplier, project.RetryMaxDelay,
+		project.AssignStrategy, project.MaxInFlightPerGroup, project.DefaultMaxConcurrentTasks,
+		project.DedupMode, project.DedupTtl, project.MaxVerificationAttempts, project.MinReputation,
+		project.TrustedReputation, project.TrustedVerificationCount, project.KeepCompletedTasks,
+		project.ArchiveTasks, project.RecipeSchema)
 
 	var id int64
-	err := row.Scan(&id)
+	err = row.Scan(&id)
+	if err == nil {
+		err = setProjectChains(txn, id, project.Chains)
+	}
+	if err == nil {
+		err = txn.Commit()
+	} else {
+		_ = txn.Rollback()
+	}
 
 	if err != nil {
 		logrus.WithError(err).WithFields(logrus.Fields{
@@ -60,6 +153,7 @@ func (database *Database) SaveProject(project *Project, webhookSecret string) (i
 	return id, nil
 }
 
+// Bypasses the project cache
 func (database *Database) GetProject(id int64) *Project {
 
 	if database.projectCache[id] != nil {
@@ -67,9 +161,7 @@ func (database *Database) GetProject(id int64) *Project {
 	}
 
 	db := database.getDB()
-	row := db.QueryRow(`SELECT id, priority, name, clone_url, git_repo, version,
-       motd, public, hidden, COALESCE(chain, 0), paused, assign_rate, submit_rate
-		FROM project WHERE id=$1`, id)
+	row := db.QueryRow(`SELECT `+projectColumns+` FROM project WHERE id=$1`, id)
 
 	project, err := scanProject(row)
 	if err != nil {
@@ -89,21 +181,73 @@ func (database *Database) GetProject(id int64) *Project {
 	return project
 }
 
-func scanProject(row *sql.Row) (*Project, error) {
+func scanProject(row scanner) (*Project, error) {
 
 	p := &Project{}
+	var chains string
 	err := row.Scan(&p.Id, &p.Priority, &p.Name, &p.CloneUrl, &p.GitRepo, &p.Version,
-		&p.Motd, &p.Public, &p.Hidden, &p.Chain, &p.Paused, &p.AssignRate, &p.SubmitRate)
+		&p.Motd, &p.Public, &p.Hidden, &p.Chain, &p.Paused, &p.AssignRate, &p.SubmitRate,
+		&p.RetryDelay, &p.RetryMultiplier, &p.RetryMaxDelay, &p.AssignStrategy, &p.MaxInFlightPerGroup,
+		&p.DefaultMaxConcurrentTasks, &p.DedupMode, &p.DedupTtl, &p.MaxVerificationAttempts,
+		&p.MinReputation, &p.TrustedReputation, &p.TrustedVerificationCount,
+		&p.KeepCompletedTasks, &p.ArchiveTasks, &p.RecipeSchema, &chains)
+	if err != nil {
+		return p, err
+	}
+
+	err = json.Unmarshal([]byte(chains), &p.Chains)
 
 	return p, err
 }
 
+func setProjectChains(q queryer, pid int64, chains []ProjectChain) error {
+
+	_, err := q.Exec(`DELETE FROM project_chain WHERE project=$1`, pid)
+	if err != nil {
+		return err
+	}
+
+	for _, chain := range chains {
+		_, err := q.Exec(`INSERT INTO project_chain (project, target, priority, fields, template) 
+			VALUES ($1,$2,$3,$4,NULLIF($5, ''))`,
+			pid, chain.Target, chain.Priority, pq.Array(chain.Fields), chain.Template)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the projects that receive the closed tasks of each project,
+// either through project.chain or project_chain
+func (database *Database) GetChainGraph() map[int64][]int64 {
+
+	db := database.getDB()
+
+	rows, err := db.Query(`SELECT id, chain FROM project WHERE chain IS NOT NULL
+		UNION SELECT project, target FROM project_chain`)
+	handleErr(err)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	graph := make(map[int64][]int64)
+	for rows.Next() {
+		var project, target int64
+		err := rows.Scan(&project, &target)
+		handleErr(err)
+		graph[project] = append(graph[project], target)
+	}
+
+	return graph
+}
+
 func (database *Database) GetProjectWithRepoName(repoName string) *Project {
 
 	db := database.getDB()
-	row := db.QueryRow(`SELECT id, priority, name, clone_url, git_repo, version,
-       motd, public, hidden, COALESCE(chain, 0), paused, assign_rate, submit_rate
-		FROM project WHERE LOWER(git_repo)=$1`,
+	row := db.QueryRow(`SELECT `+projectColumns+` FROM project WHERE LOWER(git_repo)=$1`,
 		strings.ToLower(repoName))
 
 	project, err := scanProject(row)
@@ -121,14 +265,36 @@ func (database *Database) UpdateProject(project *Project) error {
 
 	db := database.getDB()
 
-	res, err := db.Exec(`UPDATE project 
+	txn, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	res, err := txn.Exec(`UPDATE project 
 		SET (priority, name, clone_url, git_repo, version, motd, public, hidden, chain, paused,
-		    assign_rate, submit_rate) =
-		  ($1,$2,$3,$4,$5,$6,$7,$8,NULLIF($9, 0), $10,$11,$12)
-		WHERE id=$13`,
+		    assign_rate, submit_rate, retry_delay, retry_multiplier, retry_max_delay, assign_strategy,
+		    max_in_flight_per_group, default_max_concurrent_tasks, dedup_mode, dedup_ttl,
+		    max_verification_attempts, min_reputation, trusted_reputation, trusted_verification_count,
+		    keep_completed_tasks, archive_tasks, recipe_schema) =
+		  ($1,$2,$3,$4,$5,$6,$7,$8,NULLIF($9, 0), $10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25,
+		   $26,$27)
+		WHERE id=$28`,
 		project.Priority, project.Name, project.CloneUrl, project.GitRepo, project.Version, project.Motd,
 		project.Public, project.Hidden, project.Chain, project.Paused, project.AssignRate, project.SubmitRate,
-		project.Id)
+		project.RetryDelay, project.RetryMultiplier, project.RetryMaxDelay, project.AssignStrategy,
+		project.MaxInFlightPerGroup, project.DefaultMaxConcurrentTasks, project.DedupMode, project.DedupTtl,
+		project.MaxVerificationAttempts, project.MinReputation, project.TrustedReputation,
+		project.TrustedVerificationCount, project.KeepCompletedTasks, project.ArchiveTasks,
+		project.RecipeSchema, project.Id)
+	if err == nil {
+		err = setProjectChains(txn, project.Id, project.Chains)
+	}
+	if err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+
+	err = txn.Commit()
 	if err != nil {
 		return err
 	}
@@ -152,16 +318,12 @@ func (database Database) GetAllProjects(managerId int64) *[]Project {
 	var rows *sql.Rows
 	var err error
 	if managerId == 0 {
-		rows, err = db.Query(`SELECT 
-       	Id, priority, name, clone_url, git_repo, version, motd, public, hidden, COALESCE(chain,0), paused,
-       	assign_rate, submit_rate
+		rows, err = db.Query(`SELECT ` + projectColumns + `
 		FROM project
 		WHERE NOT hidden
 		ORDER BY name`)
 	} else {
-		rows, err = db.Query(`SELECT 
-       	Id, priority, name, clone_url, git_repo, version, motd, public, hidden, COALESCE(chain,0), paused,
-       assign_rate, submit_rate
+		rows, err = db.Query(`SELECT `+projectColumns+`
 		FROM project
 		LEFT JOIN manager_has_role_on_project mhrop ON mhrop.project = id AND mhrop.manager=$1
 		WHERE NOT hidden OR mhrop.role & 1 = 1 OR (SELECT tracker_admin FROM manager WHERE id=$1)
@@ -173,12 +335,9 @@ func (database Database) GetAllProjects(managerId int64) *[]Project {
 	}
 
 	for rows.Next() {
-		p := Project{}
-		err := rows.Scan(&p.Id, &p.Priority, &p.Name, &p.CloneUrl,
-			&p.GitRepo, &p.Version, &p.Motd, &p.Public, &p.Hidden,
-			&p.Chain, &p.Paused, &p.AssignRate, &p.SubmitRate)
+		p, err := scanProject(rows)
 		handleErr(err)
-		projects = append(projects, p)
+		projects = append(projects, *p)
 	}
 
 	logrus.WithFields(logrus.Fields{
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+)
+
+// Every worker that releases a task with an output gets its own record. For tasks
+// that need verification, Closed tells which release closed the task, the other
+// records that agree with it have the same Verification hash
+type TaskResultRecord struct {
+	Id           int64           `json:"id"`
+	Task         int64           `json:"task"`
+	Recipe       string          `json:"recipe"`
+	Worker       int64           `json:"worker"`
+	Verification int64           `json:"verification"`
+	Closed       bool            `json:"closed"`
+	Output       json.RawMessage `json:"output"`
+	Timestamp    int64           `json:"timestamp"`
+}
+
+const resultColumns = `id, task, recipe, worker, verification, closed, output, timestamp`
+
+func scanResult(row scanner) (*TaskResultRecord, error) {
+
+	result := &TaskResultRecord{}
+	var output string
+
+	err := row.Scan(&result.Id, &result.Task, &result.Recipe, &result.Worker, &result.Verification,
+		&result.Closed, &output, &result.Timestamp)
+	result.Output = json.RawMessage(output)
+
+	return result, err
+}
+
+// Releases the task with TR_OK and saves the worker's output along with
+// the recipe that produced it, even if the task is not closed yet
+func releaseTaskWithOutput(q queryer, id int64, workerId int64, verification int64, output string) (bool, error) {
+
+	var project int64
+	var recipe string
+
+	// The task row is gone once release_task_ok closes it
+	row := q.QueryRow(`SELECT project, recipe FROM task WHERE id=$1 AND assignee=$2`, id, workerId)
+	err := row.Scan(&project, &recipe)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	handleErr(err)
+	if err != nil {
+		return false, err
+	}
+
+	var taskUpdated bool
+	row = q.QueryRow(`SELECT release_task_ok($1,$2,$3)`, workerId, id, verification)
+	err = row.Scan(&taskUpdated)
+	handleErr(err)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = q.Exec(`INSERT INTO task_result (project, task, recipe, worker, verification, closed, output, timestamp)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,extract(epoch from now() at time zone 'utc'))`,
+		project, id, recipe, workerId, verification, taskUpdated, output)
+	handleErr(err)
+	if err != nil {
+		return false, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"project": project,
+		"task":    id,
+		"worker":  workerId,
+	}).Trace("Database.releaseTaskWithOutput INSERT task_result")
+
+	return taskUpdated, nil
+}
+
+// Returns up to count results with an id greater than after
+func (database *Database) GetResults(pid int64, after int64, count int) []TaskResultRecord {
+
+	db := database.getDB()
+
+	rows, err := db.Query(`SELECT `+resultColumns+` FROM task_result
+		WHERE project=$1 AND id>$2 ORDER BY id LIMIT $3`, pid, after, count)
+	handleErr(err)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	results := make([]TaskResultRecord, 0)
+	for rows.Next() {
+		result, err := scanResult(rows)
+		handleErr(err)
+		results = append(results, *result)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"project": pid,
+		"after":   after,
+		"count":   len(results),
+	}).Trace("Database.GetResults")
+
+	return results
+}
+
+// Calls fn for every result of the project, in insertion order
+func (database *Database) ExportResults(pid int64, fn func(result *TaskResultRecord) error) error {
+
+	db := database.getDB()
+
+	rows, err := db.Query(`SELECT `+resultColumns+` FROM task_result
+		WHERE project=$1 ORDER BY id`, pid)
+	handleErr(err)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		result, err := scanResult(rows)
+		if err != nil {
+			return err
+		}
+		err = fn(result)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -2,9 +2,12 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
+	"math"
+	"strings"
 )
 
 type Task struct {
@@ -19,6 +22,13 @@ type Task struct {
 	MaxAssignTime     int64      `json:"max_assign_time"`
 	AssignTime        int64      `json:"assign_time"`
 	VerificationCount int16      `json:"verification_count"`
+	LeaseRemaining    int64      `json:"lease_remaining"`
+	Progress          float32    `json:"progress"`
+	Checkpoint        string     `json:"checkpoint,omitempty"`
+	NotBefore         int64      `json:"not_before"`
+	RetryAfter        int64      `json:"retry_after"`
+	Group             string     `json:"group"`
+	RequiredTags      []string   `json:"required_tags"`
 }
 
 type TaskStatus int
@@ -26,8 +36,22 @@ type TaskStatus int
 const (
 	NEW    TaskStatus = 1
 	FAILED TaskStatus = 2
+
+	// The workers could not agree on a verification hash
+	// within the project's max_verification_attempts
+	DISPUTED TaskStatus = 3
+
+	ASSIGNED TaskStatus = 4
+	// Unassigned, with verifications that did not reach the verification_count yet
+	AWAITING_VERIFICATION TaskStatus = 5
+	// Only kept by projects with keep_completed_tasks, other tasks are deleted
+	COMPLETED TaskStatus = 6
+	CANCELLED TaskStatus = 7
 )
 
+// The allowed transitions are in the task_status_transition table, see schema.sql.
+// ASSIGNED, NEW and AWAITING_VERIFICATION are set by the database when the assignee changes
+
 type TaskResult int
 
 const (
@@ -37,10 +61,28 @@ const (
 )
 
 type SaveTaskRequest struct {
-	Task     *Task
-	Project  int64
-	Hash64   int64
-	WorkerId int64
+	Task         *Task
+	Project      int64
+	Hash64       int64
+	WorkerId     int64
+	Dependencies []TaskDependency
+}
+
+// The parent is either TaskId or the task of Project with Hash64
+type TaskDependency struct {
+	TaskId         int64
+	Project        int64
+	Hash64         int64
+	CascadeFailure bool
+}
+
+var ErrDuplicateTask = errors.New("a task with the same hash already exists in this project")
+var ErrRecentlyCompleted = errors.New("a task with the same hash was recently completed in this project")
+var ErrUnresolvedDependency = errors.New("a dependency could not be found")
+var ErrFailedDependency = errors.New("a dependency has failed or was cancelled")
+
+func (database *Database) HasSubmitAccess(workerId, projectId int64) bool {
+	return database.checkAccess(workerId, projectId, false, true)
 }
 
 func (database *Database) checkAccess(workerId, projectId int64, assign, submit bool) bool {
@@ -86,29 +128,142 @@ func (database *Database) checkAccess(workerId, projectId int64, assign, submit
 	return true
 }
 
-func (database *Database) SaveTask(task *Task, project int64, hash64 int64, wid int64) error {
+func (database *Database) SaveTask(task *Task, project int64, hash64 int64, wid int64,
+	dependencies []TaskDependency) (int64, error) {
 
 	if !database.checkAccess(wid, project, false, true) {
-		return errors.New("unauthorized task submit")
+		return 0, errors.New("unauthorized task submit")
 	}
 
 	db := database.getDB()
 
-	_, err := db.Exec(`INSERT INTO task 
-			(project, max_retries, recipe, priority, max_assign_time, hash64, verification_count) 
-			VALUES ($1,$2,$3,$4,$5,$6,$7)`,
-		project, task.MaxRetries, task.Recipe, task.Priority, task.MaxAssignTime,
-		makeNullableInt(hash64), task.VerificationCount)
+	txn, err := db.Begin()
+	handleErr(err)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := saveTask(txn, &SaveTaskRequest{
+		Task:         task,
+		Project:      project,
+		Hash64:       hash64,
+		WorkerId:     wid,
+		Dependencies: dependencies,
+	})
 	if err != nil {
+		_ = txn.Rollback()
 		logrus.WithError(err).WithFields(logrus.Fields{
 			"task": task,
 		}).Trace("Database.saveTask INSERT task ERROR")
+		return 0, err
+	}
+
+	err = txn.Commit()
+	handleErr(err)
+
+	return id, err
+}
+
+func saveTask(q queryer, req *SaveTaskRequest) (int64, error) {
+
+	if req.Hash64 != 0 {
+		var completed bool
+		err := q.QueryRow(`SELECT EXISTS(SELECT 1 FROM completed_hash ch
+			INNER JOIN project ON project.id = ch.project
+			WHERE ch.project=$1 AND ch.hash64=$2 AND `+completedHashCondition+`)`,
+			req.Project, req.Hash64).Scan(&completed)
+		if err != nil {
+			return 0, err
+		}
+		if completed {
+			return 0, ErrRecentlyCompleted
+		}
+	}
+
+	var id int64
+	err := q.QueryRow(`INSERT INTO task 
+			(project, max_retries, recipe, priority, max_assign_time, hash64, verification_count, not_before,
+			 group_key, required_tags, recipe_is_object) 
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) ON CONFLICT DO NOTHING RETURNING id`,
+		req.Project, req.Task.MaxRetries, req.Task.Recipe, req.Task.Priority, req.Task.MaxAssignTime,
+		makeNullableInt(req.Hash64), req.Task.VerificationCount, req.Task.NotBefore, req.Task.Group,
+		pq.Array(makeTagList(req.Task.RequiredTags)), isJsonObject(req.Task.Recipe)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrDuplicateTask
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for _, dep := range req.Dependencies {
+		err := saveTaskDependency(q, id, req, &dep)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+func saveTaskDependency(q queryer, id int64, req *SaveTaskRequest, dep *TaskDependency) error {
+
+	var parent int64
+	var status TaskStatus
+	err := q.QueryRow(`SELECT task.id, task.status FROM task
+		INNER JOIN project ON task.project = project.id
+		LEFT JOIN worker_access wa ON wa.project = task.project AND wa.worker=$1
+		WHERE (task.id=$2 OR ($2=0 AND task.project=$3 AND task.hash64=$4))
+			AND task.id != $5
+			AND (task.project=$6 OR project.public OR ((wa.role_submit OR wa.role_assign) AND NOT wa.request))
+		ORDER BY task.status = 6
+		LIMIT 1`,
+		req.WorkerId, dep.TaskId, dep.Project, dep.Hash64, id, req.Project).Scan(&parent, &status)
+	if err == sql.ErrNoRows {
+		return resolveClosedDependency(q, dep)
+	}
+	if err != nil {
 		return err
 	}
 
+	switch status {
+	case COMPLETED:
+		return nil
+	case FAILED, CANCELLED:
+		return ErrFailedDependency
+	}
+
+	_, err = q.Exec(`INSERT INTO task_dependency (task, parent, cascade_failure)
+		VALUES ($1,$2,$3) ON CONFLICT DO NOTHING`, id, parent, dep.CascadeFailure)
+	return err
+}
+
+// Closed tasks are deleted, a parent that is not in the task table is only
+// accepted if it is known to be completed: archived, or for parents referenced
+// by hash, still in the completed hashes of its project
+func resolveClosedDependency(q queryer, dep *TaskDependency) error {
+
+	var completed bool
+	err := q.QueryRow(`SELECT EXISTS(SELECT 1 FROM task_archive ta
+			WHERE ta.status=6 AND (ta.id=$1 OR ($1=0 AND ta.project=$2 AND ta.hash64=$3)))
+		OR ($1=0 AND EXISTS(SELECT 1 FROM completed_hash ch WHERE ch.project=$2 AND ch.hash64=$3))`,
+		dep.TaskId, dep.Project, dep.Hash64).Scan(&completed)
+	if err != nil {
+		return err
+	}
+	if !completed {
+		return ErrUnresolvedDependency
+	}
 	return nil
 }
 
+// Recipes that postgres can parse as a JSON object. jsonb
+// rejects \u0000, which encoding/json accepts
+func isJsonObject(recipe string) bool {
+	var obj map[string]json.RawMessage
+	return json.Unmarshal([]byte(recipe), &obj) == nil && obj != nil &&
+		!strings.Contains(recipe, `\u0000`)
+}
+
 func makeNullableInt(i int64) sql.NullInt64 {
 	if i == 0 {
 		return sql.NullInt64{Valid: false}
@@ -120,112 +275,1081 @@ func makeNullableInt(i int64) sql.NullInt64 {
 	}
 }
 
-func (database Database) BulkSaveTask(bulkSaveTaskReqs []SaveTaskRequest) []error {
+// Hashes of completed tasks are kept by projects with a dedup_mode,
+// until they expire for DEDUP_TTL
+const completedHashCondition = `(project.dedup_mode=2 OR (project.dedup_mode=1
+	AND ch.timestamp + project.dedup_ttl > extract(epoch from now() at time zone 'utc')))`
+
+// Sets ErrRecentlyCompleted for the requests whose hash is in completed_hash
+func markRecentlyCompleted(txn *sql.Tx, reqs []SaveTaskRequest, results []SaveTaskResult) error {
+
+	hashes := make([]int64, 0, len(reqs))
+	for _, req := range reqs {
+		if req.Hash64 != 0 {
+			hashes = append(hashes, req.Hash64)
+		}
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	rows, err := txn.Query(`SELECT ch.hash64 FROM completed_hash ch
+		INNER JOIN project ON project.id = ch.project
+		WHERE ch.project=$1 AND ch.hash64 = ANY($2) AND `+completedHashCondition,
+		reqs[0].Project, pq.Array(hashes))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	completed := make(map[int64]bool)
+	for rows.Next() {
+		var hash int64
+		err := rows.Scan(&hash)
+		if err != nil {
+			return err
+		}
+		completed[hash] = true
+	}
+
+	for i, req := range reqs {
+		if req.Hash64 != 0 && completed[req.Hash64] {
+			results[i].Err = ErrRecentlyCompleted
+		}
+	}
+	return nil
+}
+
+// Only the first request of the batch with a given hash can be inserted
+func markBatchDuplicates(reqs []SaveTaskRequest, results []SaveTaskResult) {
+
+	seen := make(map[int64]bool)
+	for i, req := range reqs {
+		if req.Hash64 == 0 || results[i].Err != nil {
+			continue
+		}
+		if seen[req.Hash64] {
+			results[i].Err = ErrDuplicateTask
+		}
+		seen[req.Hash64] = true
+	}
+}
+
+// Id is the id of the inserted task, or 0 if Err is set
+type SaveTaskResult struct {
+	Id  int64
+	Err error
+}
+
+// Inserts the tasks without dependencies with a single statement. Ids are taken
+// from the sequence beforehand so that the RETURNING clause can be matched with
+// the requests, the requests that are not returned were duplicates
+func bulkInsertTasks(txn *sql.Tx, reqs []SaveTaskRequest, results []SaveTaskResult) error {
+
+	indices := make([]int, 0, len(reqs))
+	for i, req := range reqs {
+		if len(req.Dependencies) == 0 && results[i].Err == nil {
+			indices = append(indices, i)
+		}
+	}
+	if len(indices) == 0 {
+		return nil
+	}
+
+	rows, err := txn.Query(`SELECT nextval('task_id_seq') FROM generate_series(1, $1)`, len(indices))
+	if err != nil {
+		return err
+	}
+	ids := make([]int64, 0, len(indices))
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	_ = rows.Close()
+
+	maxRetries := make([]int64, len(indices))
+	recipes := make([]string, len(indices))
+	priorities := make([]int64, len(indices))
+	maxAssignTimes := make([]int64, len(indices))
+	hashes := make([]int64, len(indices))
+	verificationCounts := make([]int64, len(indices))
+	notBefores := make([]int64, len(indices))
+	groups := make([]string, len(indices))
+	tags := make([]string, len(indices))
+	isObject := make([]bool, len(indices))
+	byId := make(map[int64]int, len(indices))
+	for j, i := range indices {
+		task := reqs[i].Task
+		maxRetries[j] = int64(task.MaxRetries)
+		recipes[j] = task.Recipe
+		priorities[j] = int64(task.Priority)
+		maxAssignTimes[j] = task.MaxAssignTime
+		hashes[j] = reqs[i].Hash64
+		verificationCounts[j] = int64(task.VerificationCount)
+		notBefores[j] = task.NotBefore
+		groups[j] = task.Group
+		tagList, _ := pq.StringArray(makeTagList(task.RequiredTags)).Value()
+		tags[j] = tagList.(string)
+		isObject[j] = isJsonObject(task.Recipe)
+		byId[ids[j]] = i
+	}
+
+	rows, err = txn.Query(`INSERT INTO task 
+			(id, project, max_retries, recipe, priority, max_assign_time, hash64, verification_count, not_before,
+			 group_key, required_tags, recipe_is_object)
+		SELECT r.id, $1, r.max_retries, r.recipe, r.priority, r.max_assign_time, NULLIF(r.hash64, 0),
+			r.verification_count, r.not_before, r.group_key, r.required_tags::TEXT[], r.recipe_is_object
+		FROM unnest($2::INT[], $3::SMALLINT[], $4::TEXT[], $5::SMALLINT[], $6::INT[], $7::BIGINT[],
+			$8::SMALLINT[], $9::INT[], $10::TEXT[], $11::TEXT[], $12::BOOLEAN[])
+			AS r(id, max_retries, recipe, priority, max_assign_time, hash64, verification_count, not_before,
+				group_key, required_tags, recipe_is_object)
+		ON CONFLICT DO NOTHING RETURNING id`,
+		reqs[0].Project, pq.Array(ids), pq.Array(maxRetries), pq.Array(recipes), pq.Array(priorities),
+		pq.Array(maxAssignTimes), pq.Array(hashes), pq.Array(verificationCounts), pq.Array(notBefores),
+		pq.Array(groups), pq.Array(tags), pq.Array(isObject))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			return err
+		}
+		results[byId[id]].Id = id
+	}
+
+	for _, i := range indices {
+		if results[i].Id == 0 {
+			results[i].Err = ErrDuplicateTask
+		}
+	}
+	return rows.Err()
+}
+
+// Returns the result of each request, duplicates and recently completed tasks
+// are skipped without failing the batch. Tasks with dependencies are inserted
+// one by one after the others, so they can depend on tasks of the same batch.
+// An error is returned if the whole batch failed
+func (database Database) BulkSaveTask(bulkSaveTaskReqs []SaveTaskRequest) ([]SaveTaskResult, error) {
 
 	if !database.checkAccess(bulkSaveTaskReqs[0].WorkerId, bulkSaveTaskReqs[0].Project,
 		false, true) {
-		return []error{errors.New("unauthorized task submit")}
+		return nil, errors.New("unauthorized task submit")
+	}
+
+	db := database.getDB()
+
+	txn, err := db.Begin()
+	handleErr(err)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SaveTaskResult, len(bulkSaveTaskReqs))
+	err = markRecentlyCompleted(txn, bulkSaveTaskReqs, results)
+	if err == nil {
+		markBatchDuplicates(bulkSaveTaskReqs, results)
+		err = bulkInsertTasks(txn, bulkSaveTaskReqs, results)
+	}
+	if err != nil {
+		_ = txn.Rollback()
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"count": len(bulkSaveTaskReqs),
+		}).Error("Database.BulkSaveTask INSERT task ERROR")
+		return nil, err
 	}
 
+	for i := range bulkSaveTaskReqs {
+		if len(bulkSaveTaskReqs[i].Dependencies) == 0 || results[i].Err != nil {
+			continue
+		}
+		_, err = txn.Exec(`SAVEPOINT save_task`)
+		handleErr(err)
+		results[i].Id, results[i].Err = saveTask(txn, &bulkSaveTaskReqs[i])
+		if results[i].Err != nil {
+			_, err = txn.Exec(`ROLLBACK TO SAVEPOINT save_task`)
+			handleErr(err)
+		}
+	}
+
+	err = txn.Commit()
+	handleErr(err)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"count": len(bulkSaveTaskReqs),
+	}).Trace("Database.BulkSaveTask")
+
+	return results, nil
+}
+
+type ReleaseRequest struct {
+	TaskId       int64
+	Result       TaskResult
+	Verification int64
+	Message      string
+	Details      string
+	Output       string
+	Children     []SaveTaskRequest
+}
+
+type TaskAttempt struct {
+	Worker    int64           `json:"worker"`
+	Result    TaskResult      `json:"result"`
+	Message   string          `json:"message"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	Timestamp int64           `json:"timestamp"`
+}
+
+type FailedTask struct {
+	Id          int64        `json:"id"`
+	Priority    int16        `json:"priority"`
+	Retries     int16        `json:"retries"`
+	MaxRetries  int16        `json:"max_retries"`
+	Recipe      string       `json:"recipe"`
+	LastAttempt *TaskAttempt `json:"last_attempt"`
+}
+
+type TaskLease struct {
+	TaskId         int64 `json:"task_id"`
+	Updated        bool  `json:"updated"`
+	LeaseRemaining int64 `json:"lease_remaining"`
+}
+
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Children has the result of each child task, in the same
+// order as the request, if the release closed the task
+type ReleaseResult struct {
+	Updated  bool
+	Children []SaveTaskResult
+	Err      error
+}
+
+func (database Database) ReleaseTask(req ReleaseRequest, workerId int64) ReleaseResult {
+
 	db := database.getDB()
 
 	txn, err := db.Begin()
 	handleErr(err)
+	if err != nil {
+		return ReleaseResult{Err: err}
+	}
 
-	errs := make([]error, len(bulkSaveTaskReqs))
+	taskUpdated, children, err := releaseTask(txn, req, workerId)
+	if err != nil {
+		_ = txn.Rollback()
+		return ReleaseResult{Err: err}
+	}
 
-	stmt, _ := txn.Prepare(pq.CopyIn(
-		"task",
-		"project", "max_retries", "recipe", "priority",
-		"max_assign_time", "hash64", "verification_count",
-	))
+	err = txn.Commit()
+	handleErr(err)
+	if err != nil {
+		return ReleaseResult{Err: err}
+	}
+
+	return ReleaseResult{Updated: taskUpdated, Children: children}
+}
+
+// Each release runs behind a savepoint, so that an error
+// only fails its own release instead of the whole batch
+func (database Database) BulkReleaseTask(reqs []ReleaseRequest, workerId int64) []ReleaseResult {
 
-	for i, req := range bulkSaveTaskReqs {
-		_, err = stmt.Exec(req.Project, req.Task.MaxRetries, req.Task.Recipe,
-			req.Task.Priority, req.Task.MaxAssignTime, makeNullableInt(req.Hash64),
-			req.Task.VerificationCount)
+	db := database.getDB()
+
+	txn, err := db.Begin()
+	handleErr(err)
+	if err != nil {
+		return nil
+	}
+
+	results := make([]ReleaseResult, len(reqs))
+	for i, req := range reqs {
+		_, err = txn.Exec(`SAVEPOINT release_task`)
+		handleErr(err)
 		if err != nil {
-			errs[i] = err
+			_ = txn.Rollback()
+			return nil
+		}
+		results[i].Updated, results[i].Children, results[i].Err = releaseTask(txn, req, workerId)
+		if results[i].Err != nil {
+			results[i].Updated = false
+			results[i].Children = nil
+			_, err = txn.Exec(`ROLLBACK TO SAVEPOINT release_task`)
+			handleErr(err)
+			if err != nil {
+				_ = txn.Rollback()
+				return nil
+			}
 		}
 	}
 
-	_, err = stmt.Exec()
-	err = stmt.Close()
-	handleErr(err)
 	err = txn.Commit()
 	handleErr(err)
+	if err != nil {
+		return nil
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"count":  len(reqs),
+		"worker": workerId,
+	}).Trace("Database.BulkReleaseTask")
 
-	return errs
+	return results
 }
 
-func (database Database) ReleaseTask(id int64, workerId int64, result TaskResult, verification int64) bool {
+// Pushes assign_time forward for the tasks that are currently
+// assigned to workerId, other tasks are left untouched
+func (database *Database) ExtendTaskLease(ids []int64, workerId int64) []TaskLease {
 
 	db := database.getDB()
 
+	rows, err := db.Query(`UPDATE task SET assign_time=extract(epoch from now() at time zone 'utc')
+		WHERE id = ANY($1) AND assignee=$2
+		RETURNING id, max_assign_time`, pq.Array(ids), workerId)
+	handleErr(err)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	extended := make(map[int64]int64)
+	for rows.Next() {
+		var id, maxAssignTime int64
+		err := rows.Scan(&id, &maxAssignTime)
+		handleErr(err)
+		extended[id] = maxAssignTime
+	}
+
+	leases := make([]TaskLease, len(ids))
+	for i, id := range ids {
+		leases[i].TaskId = id
+		leases[i].LeaseRemaining, leases[i].Updated = extended[id]
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"worker":   workerId,
+		"count":    len(ids),
+		"extended": len(extended),
+	}).Trace("Database.ExtendTaskLease UPDATE task")
+
+	return leases
+}
+
+// An empty checkpoint leaves the previous checkpoint untouched
+func (database *Database) SetTaskProgress(id int64, workerId int64, progress float32, checkpoint string) bool {
+
+	db := database.getDB()
+
+	res, err := db.Exec(`UPDATE task SET progress=$1, checkpoint=COALESCE(NULLIF($2, ''), checkpoint)
+		WHERE id=$3 AND assignee=$4`, progress, checkpoint, id, workerId)
+	handleErr(err)
+	if err != nil {
+		return false
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+
+	logrus.WithFields(logrus.Fields{
+		"id":           id,
+		"worker":       workerId,
+		"progress":     progress,
+		"rowsAffected": rowsAffected,
+	}).Trace("Database.SetTaskProgress UPDATE task")
+
+	return rowsAffected == 1
+}
+
+func releaseTask(q queryer, req ReleaseRequest, workerId int64) (bool, []SaveTaskResult, error) {
+
+	id := req.TaskId
+	result := req.Result
+	verification := req.Verification
+
+	// The attempt is recorded before the task is released, since
+	// a successful release may delete the task
+	_, err := q.Exec(`INSERT INTO task_attempt (task, worker, result, message, details, timestamp)
+		SELECT id, $2, $3, $4, NULLIF($5, ''), extract(epoch from now() at time zone 'utc')
+		FROM task WHERE id=$1 AND assignee=$2`,
+		id, workerId, result, req.Message, req.Details)
+	handleErr(err)
+	if err != nil {
+		return false, nil, err
+	}
+
 	var taskUpdated bool
-	if result == TR_OK {
-		row := db.QueryRow(`SELECT release_task_ok($1,$2,$3)`, workerId, id, verification)
+	if result == TR_OK && req.Output != "" {
+		taskUpdated, err = releaseTaskWithOutput(q, id, workerId, verification, req.Output)
+		if err != nil {
+			return false, nil, err
+		}
+	} else if result == TR_OK {
+		row := q.QueryRow(`SELECT release_task_ok($1,$2,$3)`, workerId, id, verification)
 
 		err := row.Scan(&taskUpdated)
+		handleErr(err)
 		if err != nil {
-			taskUpdated = false
+			return false, nil, err
+		}
+	}
+
+	var children []SaveTaskResult
+	if result == TR_OK {
+		// Only the release that closes the task submits its children
+		if taskUpdated && len(req.Children) != 0 {
+			children, err = saveChildren(q, req.Children)
+			if err != nil {
+				return false, nil, err
+			}
 		}
 	} else if result == TR_FAIL {
-		res, err := db.Exec(`UPDATE task SET (status, assignee, retries) = 
-			(CASE WHEN retries+1 >= max_retries THEN 2 ELSE 1 END, NULL, retries+1)
-			WHERE id=$1 AND assignee=$2`, id, workerId)
+		// With a retry policy, the task isn't assignable until
+		// retry_delay * retry_multiplier^retries seconds have passed.
+		// The backoff is kept apart from the not_before set by the submitter
+		res, err := q.Exec(`UPDATE task SET (status, assignee, retries, retry_after) = 
+			(CASE WHEN retries+1 >= max_retries THEN 2 ELSE 1 END, NULL, retries+1,
+			 CASE WHEN p.retry_delay > 0 THEN
+			 	extract(epoch from now() at time zone 'utc')::INT + LEAST(
+			 		p.retry_delay * power(p.retry_multiplier, LEAST(task.retries, 64)),
+			 		p.retry_max_delay)::INT
+			 ELSE task.retry_after END)
+			FROM project p
+			WHERE task.id=$1 AND task.assignee=$2 AND p.id=task.project`, id, workerId)
 		handleErr(err)
+		if err != nil {
+			return false, nil, err
+		}
 		rowsAffected, _ := res.RowsAffected()
 		taskUpdated = rowsAffected == 1
 	} else if result == TR_SKIP {
-		res, err := db.Exec(`UPDATE task SET (status, assignee) = (1, NULL)
+		res, err := q.Exec(`UPDATE task SET (status, assignee) = (1, NULL)
 			WHERE id=$1 AND assignee=$2`, id, workerId)
 		handleErr(err)
+		if err != nil {
+			return false, nil, err
+		}
 		rowsAffected, _ := res.RowsAffected()
 		taskUpdated = rowsAffected == 1
 	}
 
-	return taskUpdated
+	return taskUpdated, children, nil
 }
 
-func (database *Database) GetTaskFromProject(worker *Worker, projectId int64) *Task {
+// Each child is inserted behind a savepoint, a child that can't
+// be inserted is reported without failing the release
+func saveChildren(q queryer, children []SaveTaskRequest) ([]SaveTaskResult, error) {
+
+	results := make([]SaveTaskResult, len(children))
+	for i := range children {
+		_, err := q.Exec(`SAVEPOINT save_child`)
+		handleErr(err)
+		if err != nil {
+			return nil, err
+		}
+		results[i].Id, results[i].Err = saveTask(q, &children[i])
+		if results[i].Err != nil {
+			if results[i].Err != ErrDuplicateTask && results[i].Err != ErrRecentlyCompleted {
+				logrus.WithError(results[i].Err).WithFields(logrus.Fields{
+					"project": children[i].Project,
+				}).Warn("Could not save child task")
+			}
+			_, err = q.Exec(`ROLLBACK TO SAVEPOINT save_child`)
+			handleErr(err)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return results, nil
+}
+
+// Projects are returned in a random order weighted by project priority
+// (exponential race: a project with twice the priority is twice as likely
+// to come first), so that lower priority projects are not starved
+func (database *Database) GetAssignableProjects(worker *Worker) []int64 {
 
 	db := database.getDB()
 
-	database.assignMutex.Lock()
+	rows, err := db.Query(`
+		SELECT project.id
+		FROM project
+		LEFT JOIN worker_access wa on project.id = wa.project AND wa.worker=$1
+		WHERE 
+			NOT paused
+			AND (project.public OR (wa.role_assign AND NOT request))
+			AND (project.min_reputation = 0 
+				OR (SELECT `+workerReputation+` FROM worker WHERE id=$1) >= project.min_reputation)
+			AND EXISTS (
+				SELECT 1 FROM task 
+				WHERE task.project = project.id AND assignee IS NULL AND status IN (1,5)
+				AND GREATEST(task.not_before, task.retry_after) <= extract(epoch from now() at time zone 'utc')
+				AND NOT EXISTS (SELECT 1 FROM task_dependency td WHERE td.task = task.id)
+				AND task.required_tags <@ (SELECT tags FROM worker WHERE id=$1)
+			)
+		ORDER BY -ln(1 - random()) / (GREATEST(project.priority, 0) + 1)`, worker.Id)
+	handleErr(err)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	projects := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		handleErr(err)
+		projects = append(projects, id)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"worker":   worker.Id,
+		"projects": len(projects),
+	}).Trace("Database.GetAssignableProjects SELECT")
+
+	return projects
+}
+
+func (database *Database) GetTaskFromProject(worker *Worker, projectId int64) *Task {
+
+	tasks := database.GetTasksFromProject(worker, projectId, 1)
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	return &tasks[0]
+}
+
+type AssignStrategy int
 
-	row := db.QueryRow(`
+const (
+	ASSIGN_PRIORITY AssignStrategy = 0
+	ASSIGN_FIFO     AssignStrategy = 1
+	ASSIGN_LIFO     AssignStrategy = 2
+	ASSIGN_RANDOM   AssignStrategy = 3
+	ASSIGN_FAIR     AssignStrategy = 4
+)
+
+const assignConditions = `
+				assignee IS NULL 
+				AND status IN (1,5)
+				AND (project.public OR (wa.role_assign AND NOT request))
+				AND wvt.task IS NULL
+				AND GREATEST(task.not_before, task.retry_after) <= extract(epoch from now() at time zone 'utc')
+				AND NOT EXISTS (SELECT 1 FROM task_dependency td WHERE td.task = task.id)
+				AND task.required_tags <@ (SELECT tags FROM worker WHERE id=$1)
+				AND (project.min_reputation = 0 
+					OR (SELECT ` + workerReputation + ` FROM worker WHERE id=$1) >= project.min_reputation)`
+
+const assignQueryStart = `
 		UPDATE task
 		SET assignee=$1, assign_time=extract(epoch from now() at time zone 'utc')
-		WHERE task.id = (
+		WHERE task.id IN (
 			SELECT task.id
 			FROM task
 			INNER JOIN project on task.project = project.id AND project.id=$2 AND not paused
 			LEFT JOIN worker_verifies_task wvt on task.id = wvt.task AND wvt.worker=$1
 			LEFT JOIN worker_access wa on project.id = wa.project AND wa.worker=$1
-			WHERE 
-				assignee IS NULL 
-				AND status=1
-				AND (project.public OR (wa.role_assign AND NOT request))
-				AND wvt.task IS NULL
-			ORDER BY task.priority DESC
-			LIMIT 1
+			WHERE ` + assignConditions + `
+			`
+
+// Number of tasks the worker can still be assigned in the project (max_concurrent_tasks
+// of the worker, or default_max_concurrent_tasks of the project), at most $3
+const assignLimit = `LEAST($3, (
+				SELECT CASE WHEN l.max_tasks = 0 THEN $3
+					ELSE GREATEST(l.max_tasks - (SELECT COUNT(*) FROM task WHERE assignee=$1), 0) END
+				FROM (
+					SELECT COALESCE(NULLIF(worker.max_concurrent_tasks, 0), project.default_max_concurrent_tasks) AS max_tasks
+					FROM worker, project WHERE worker.id=$1 AND project.id=$2
+				) l
+			))`
+
+const assignQueryEnd = `
+			LIMIT ` + assignLimit + `
 		)
 		RETURNING task.id, task.priority, assignee, retries, max_retries,
-				status, recipe, max_assign_time, assign_time, verification_count`, worker.Id, projectId)
+				status, recipe, max_assign_time, assign_time, verification_count, max_assign_time,
+				progress, COALESCE(checkpoint, ''), not_before, retry_after, group_key, required_tags`
 
-	database.assignMutex.Unlock()
+// Tasks are always ordered by priority first, the strategy breaks ties
+var assignQueries = map[AssignStrategy]string{
+	ASSIGN_PRIORITY: assignQueryStart + `ORDER BY task.priority DESC` + assignQueryEnd,
+	ASSIGN_FIFO:     assignQueryStart + `ORDER BY task.priority DESC, task.id ASC` + assignQueryEnd,
+	ASSIGN_LIFO:     assignQueryStart + `ORDER BY task.priority DESC, task.id DESC` + assignQueryEnd,
+	ASSIGN_RANDOM:   assignQueryStart + `ORDER BY task.priority DESC, random()` + assignQueryEnd,
+}
 
-	task := &Task{}
+const groupAssignCondition = `AND task.group_key=$4 AND task.priority >= $5
+			`
+
+// Tasks that another transaction is assigning are skipped instead of waited for
+const groupAssignQueryEnd = `
+			LIMIT ` + assignLimit + `
+			FOR UPDATE OF task SKIP LOCKED
+		)
+		RETURNING task.id, task.priority, assignee, retries, max_retries,
+				status, recipe, max_assign_time, assign_time, verification_count, max_assign_time,
+				progress, COALESCE(checkpoint, ''), not_before, retry_after, group_key, required_tags`
+
+// Tasks of the picked group, see pickGroupQueries
+var groupAssignQueries = map[AssignStrategy]string{
+	ASSIGN_PRIORITY: assignQueryStart + groupAssignCondition + `ORDER BY task.priority DESC` + groupAssignQueryEnd,
+	ASSIGN_FIFO:     assignQueryStart + groupAssignCondition + `ORDER BY task.priority DESC, task.id ASC` + groupAssignQueryEnd,
+	ASSIGN_LIFO:     assignQueryStart + groupAssignCondition + `ORDER BY task.priority DESC, task.id DESC` + groupAssignQueryEnd,
+	ASSIGN_RANDOM:   assignQueryStart + groupAssignCondition + `ORDER BY task.priority DESC, random()` + groupAssignQueryEnd,
+	ASSIGN_FAIR:     assignQueryStart + groupAssignCondition + `ORDER BY task.priority DESC, task.id` + groupAssignQueryEnd,
+}
+
+// Returns the group of the first assignable task, along with the number of
+// assigned tasks of that group and the priority of the task. Groups in $4 are
+// ignored
+const pickTaskGroupQuery = `
+		SELECT task.group_key, COALESCE(f.in_flight, 0), task.priority
+		FROM task
+		INNER JOIN project on task.project = project.id AND project.id=$2 AND not paused
+		LEFT JOIN worker_verifies_task wvt on task.id = wvt.task AND wvt.worker=$1
+		LEFT JOIN worker_access wa on project.id = wa.project AND wa.worker=$1
+		LEFT JOIN (
+			SELECT group_key, COUNT(*) AS in_flight FROM task
+			WHERE project=$2 AND assignee IS NOT NULL
+			GROUP BY group_key
+		) f ON f.group_key = task.group_key
+		WHERE ` + assignConditions + `
+		AND ($3 = 0 OR task.group_key = '' OR COALESCE(f.in_flight, 0) < $3)
+		AND NOT task.group_key = ANY($4::TEXT[])
+		`
+
+// Walks the task_group rows of the project (one per group) instead of the
+// tasks, any task of the group can then be picked
+const pickGroupQuery = `
+		SELECT tg.group_key, f.in_flight, NULL
+		FROM task_group tg, LATERAL (
+			SELECT COUNT(*) AS in_flight FROM task
+			WHERE task.project = tg.project AND task.group_key = tg.group_key AND task.assignee IS NOT NULL
+		) f
+		WHERE tg.project=$2
+		AND ($3 = 0 OR tg.group_key = '' OR f.in_flight < $3)
+		AND NOT tg.group_key = ANY($4::TEXT[])
+		AND EXISTS (
+			SELECT 1
+			FROM task
+			INNER JOIN project on task.project = project.id AND project.id=$2 AND not paused
+			LEFT JOIN worker_verifies_task wvt on task.id = wvt.task AND wvt.worker=$1
+			LEFT JOIN worker_access wa on project.id = wa.project AND wa.worker=$1
+			WHERE task.group_key = tg.group_key AND ` + assignConditions + `
+		)
+		`
+
+// Used by ASSIGN_FAIR, ASSIGN_RANDOM and when the project limits the number of
+// assigned tasks per group. ASSIGN_FAIR picks the group that was assigned the
+// longest time ago, ASSIGN_RANDOM a random group, and the other strategies the
+// group of the task they would have assigned first
+var pickGroupQueries = map[AssignStrategy]string{
+	ASSIGN_PRIORITY: pickTaskGroupQuery + `ORDER BY task.priority DESC LIMIT 1`,
+	ASSIGN_FIFO:     pickTaskGroupQuery + `ORDER BY task.priority DESC, task.id ASC LIMIT 1`,
+	ASSIGN_LIFO:     pickTaskGroupQuery + `ORDER BY task.priority DESC, task.id DESC LIMIT 1`,
+	ASSIGN_RANDOM:   pickGroupQuery + `ORDER BY random() LIMIT 1`,
+	ASSIGN_FAIR:     pickGroupQuery + `ORDER BY tg.last_assign, tg.group_key LIMIT 1`,
+}
+
+// Locks the worker row until the end of the transaction, so that concurrent
+// assignments to the same worker see each other's tasks in assignLimit
+func lockWorker(txn *sql.Tx, wid int64) error {
+
+	var locked bool
+	return txn.QueryRow(`SELECT TRUE FROM worker WHERE id=$1 FOR NO KEY UPDATE`, wid).Scan(&locked)
+}
+
+func scanAssignedTask(row scanner, project *Project) (Task, error) {
+
+	task := Task{Project: project}
 	err := row.Scan(&task.Id, &task.Priority, &task.Assignee,
 		&task.Retries, &task.MaxRetries, &task.Status, &task.Recipe, &task.MaxAssignTime,
-		&task.AssignTime, &task.VerificationCount)
+		&task.AssignTime, &task.VerificationCount, &task.LeaseRemaining,
+		&task.Progress, &task.Checkpoint, &task.NotBefore, &task.RetryAfter, &task.Group,
+		pq.Array(&task.RequiredTags))
+	return task, err
+}
+
+func (database *Database) GetTasksFromProject(worker *Worker, projectId int64, count int) []Task {
+
+	db := database.getDB()
+
+	tasks := make([]Task, 0, count)
+
+	project := database.GetProject(projectId)
+	if project == nil {
+		return tasks
+	}
+	if project.AssignStrategy == ASSIGN_FAIR || project.AssignStrategy == ASSIGN_RANDOM ||
+		project.MaxInFlightPerGroup > 0 {
+		return database.getTasksFromProjectGroups(worker, project, count)
+	}
+
+	query, ok := assignQueries[project.AssignStrategy]
+	if !ok {
+		query = assignQueries[ASSIGN_PRIORITY]
+	}
+
+	database.assignMutex.Lock()
+	defer database.assignMutex.Unlock()
+
+	txn, err := db.Begin()
+	handleErr(err)
+	if err != nil {
+		return tasks
+	}
+
+	err = lockWorker(txn, worker.Id)
+	handleErr(err)
+	if err != nil {
+		_ = txn.Rollback()
+		return tasks
+	}
+
+	rows, err := txn.Query(query, worker.Id, projectId, count)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"project": projectId,
+			"count":   count,
+		}).Warn("Database.GetTasksFromProject UPDATE task ERROR")
+		_ = txn.Rollback()
+		return tasks
+	}
+
+	for rows.Next() {
+		task, err := scanAssignedTask(rows, project)
+		if err != nil {
+			handleErr(err)
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	_ = rows.Close()
+
+	err = txn.Commit()
+	handleErr(err)
+	if err != nil {
+		return make([]Task, 0)
+	}
+	return tasks
+}
+
+// Locks the task_group row until the end of the transaction, so that other
+// assignments can't take tasks from the group, and returns the number of
+// assigned tasks of the group. Returns sql.ErrNoRows if the row is already locked
+func lockTaskGroup(txn *sql.Tx, pid int64, group string) (int64, error) {
+
+	var locked bool
+	err := txn.QueryRow(`SELECT TRUE FROM task_group WHERE project=$1 AND group_key=$2 
+		FOR UPDATE SKIP LOCKED`, pid, group).Scan(&locked)
+	if err != nil {
+		return 0, err
+	}
+
+	// Counted by a new statement, which sees the tasks assigned by the
+	// transaction that held the lock before
+	var inFlight int64
+	err = txn.QueryRow(`SELECT COUNT(*) FROM task 
+		WHERE project=$1 AND group_key=$2 AND assignee IS NOT NULL`, pid, group).Scan(&inFlight)
+	return inFlight, err
+}
+
+// Picks a group, then assigns tasks of that group until count tasks are assigned
+// or no group is left. ASSIGN_FAIR and ASSIGN_RANDOM take a single task per group
+// at a time. Groups limited by max_in_flight_per_group are locked with
+// lockTaskGroup, groups that are locked by another assignment are skipped.
+// Nothing is assigned if a query fails
+func (database *Database) getTasksFromProjectGroups(worker *Worker, project *Project, count int) []Task {
+
+	db := database.getDB()
+
+	tasks := make([]Task, 0, count)
+
+	pickQuery, ok := pickGroupQueries[project.AssignStrategy]
+	assignQuery := groupAssignQueries[project.AssignStrategy]
+	if !ok {
+		pickQuery = pickGroupQueries[ASSIGN_PRIORITY]
+		assignQuery = groupAssignQueries[ASSIGN_PRIORITY]
+	}
+	oneByOne := project.AssignStrategy == ASSIGN_FAIR || project.AssignStrategy == ASSIGN_RANDOM
+
+	txn, err := db.Begin()
+	handleErr(err)
+	if err != nil {
+		return tasks
+	}
+
+	err = lockWorker(txn, worker.Id)
+	handleErr(err)
+	if err != nil {
+		_ = txn.Rollback()
+		return tasks
+	}
+
+	skipped := make([]string, 0)
+	for len(tasks) < count {
+		var group string
+		var inFlight int64
+		var priority sql.NullInt64
+		err := txn.QueryRow(pickQuery, worker.Id, project.Id, project.MaxInFlightPerGroup, pq.Array(skipped)).
+			Scan(&group, &inFlight, &priority)
+		if err == sql.ErrNoRows {
+			break
+		}
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"project": project.Id,
+			}).Warn("Database.GetTasksFromProject SELECT group ERROR")
+			_ = txn.Rollback()
+			return make([]Task, 0)
+		}
+
+		if project.MaxInFlightPerGroup > 0 && group != "" {
+			inFlight, err = lockTaskGroup(txn, project.Id, group)
+			if err == sql.ErrNoRows || (err == nil && inFlight >= project.MaxInFlightPerGroup) {
+				skipped = append(skipped, group)
+				continue
+			}
+			if err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{
+					"project": project.Id,
+					"group":   group,
+				}).Warn("Database.GetTasksFromProject SELECT task_group ERROR")
+				_ = txn.Rollback()
+				return make([]Task, 0)
+			}
+		}
+
+		limit := count - len(tasks)
+		if oneByOne {
+			limit = 1
+		} else if project.MaxInFlightPerGroup > 0 && group != "" &&
+			int64(limit) > project.MaxInFlightPerGroup-inFlight {
+			limit = int(project.MaxInFlightPerGroup - inFlight)
+		}
+		minPriority := int64(math.MinInt16)
+		if priority.Valid {
+			minPriority = priority.Int64
+		}
+
+		rows, err := txn.Query(assignQuery, worker.Id, project.Id, limit, group, minPriority)
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"project": project.Id,
+				"group":   group,
+			}).Warn("Database.GetTasksFromProject UPDATE task ERROR")
+			_ = txn.Rollback()
+			return make([]Task, 0)
+		}
+		assigned := 0
+		for rows.Next() {
+			task, err := scanAssignedTask(rows, project)
+			if err != nil {
+				handleErr(err)
+				continue
+			}
+			tasks = append(tasks, task)
+			assigned++
+		}
+		_ = rows.Close()
+		if assigned == 0 {
+			skipped = append(skipped, group)
+			continue
+		}
+
+		if project.AssignStrategy == ASSIGN_FAIR {
+			_, err = txn.Exec(`UPDATE task_group SET last_assign=nextval('task_group_assign_seq') 
+				WHERE project=$1 AND group_key=$2`, project.Id, group)
+			if err != nil {
+				handleErr(err)
+				_ = txn.Rollback()
+				return make([]Task, 0)
+			}
+		}
+	}
 
+	err = txn.Commit()
+	handleErr(err)
+	if err != nil {
+		return make([]Task, 0)
+	}
+	return tasks
+}
+
+// Zero values and nil pointers match every task. An Assignee of -1
+// only matches unassigned tasks
+type TaskFilter struct {
+	Id          int64      `json:"id"`
+	Status      TaskStatus `json:"status"`
+	Assignee    int64      `json:"assignee"`
+	MinPriority *int16     `json:"min_priority"`
+	MaxPriority *int16     `json:"max_priority"`
+	MinRetries  *int16     `json:"min_retries"`
+	MaxRetries  *int16     `json:"max_retries"`
+	Recipe      string     `json:"recipe"`
+}
+
+// Uses $1 to $9, see TaskFilter.args()
+const taskFilterCondition = `task.project=$1
+	AND ($2=0 OR task.status=$2)
+	AND ($3=0 OR ($3=-1 AND task.assignee IS NULL) OR task.assignee=$3)
+	AND ($4::INT IS NULL OR task.priority>=$4)
+	AND ($5::INT IS NULL OR task.priority<=$5)
+	AND ($6::INT IS NULL OR task.retries>=$6)
+	AND ($7::INT IS NULL OR task.retries<=$7)
+	AND ($8='' OR strpos(task.recipe, $8)>0)
+	AND ($9=0 OR task.id=$9)`
+
+func (f *TaskFilter) args(pid int64) []interface{} {
+	return []interface{}{pid, f.Status, f.Assignee,
+		f.MinPriority, f.MaxPriority, f.MinRetries, f.MaxRetries, f.Recipe, f.Id}
+}
+
+const taskColumns = `task.id, task.priority, COALESCE(task.assignee, 0), task.retries, task.max_retries,
+	task.status, task.recipe, task.max_assign_time, COALESCE(task.assign_time, 0), task.verification_count,
+	CASE WHEN task.assignee IS NULL THEN 0 ELSE GREATEST(task.assign_time + task.max_assign_time -
+		floor(extract(epoch from now() at time zone 'utc'))::BIGINT, 0) END,
+	task.progress, COALESCE(task.checkpoint, ''), task.not_before, task.retry_after, task.group_key,
+	task.required_tags`
+
+func scanTask(row scanner) (*Task, error) {
+
+	task := &Task{}
+	err := row.Scan(&task.Id, &task.Priority, &task.Assignee, &task.Retries, &task.MaxRetries,
+		&task.Status, &task.Recipe, &task.MaxAssignTime, &task.AssignTime, &task.VerificationCount,
+		&task.LeaseRemaining, &task.Progress, &task.Checkpoint, &task.NotBefore, &task.RetryAfter, &task.Group,
+		pq.Array(&task.RequiredTags))
+
+	return task, err
+}
+
+// Returns up to count tasks matching the filter with an id greater than after
+func (database *Database) GetTasks(pid int64, filter *TaskFilter, after int64, count int) []Task {
+
+	db := database.getDB()
+
+	args := append(filter.args(pid), after, count)
+	rows, err := db.Query(`SELECT `+taskColumns+` FROM task WHERE `+taskFilterCondition+`
+		AND task.id>$10 ORDER BY task.id LIMIT $11`, args...)
+	handleErr(err)
 	if err != nil {
 		return nil
 	}
+	defer rows.Close()
+
+	tasks := make([]Task, 0)
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			handleErr(err)
+			continue
+		}
+		tasks = append(tasks, *task)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"project": pid,
+		"filter":  filter,
+		"after":   after,
+		"count":   len(tasks),
+	}).Trace("Database.GetTasks")
+
+	return tasks
+}
+
+type TaskVerification struct {
+	Worker           int64 `json:"worker"`
+	VerificationHash int64 `json:"verification_hash"`
+}
+
+type TaskDetails struct {
+	Task          *Task              `json:"task"`
+	Verifications []TaskVerification `json:"verifications"`
+	Attempts      []TaskAttempt      `json:"attempts"`
+	Dependencies  []int64            `json:"dependencies"`
+}
+
+func (database *Database) GetTaskDetails(pid int64, id int64) *TaskDetails {
+
+	db := database.getDB()
+
+	row := db.QueryRow(`SELECT `+taskColumns+` FROM task WHERE task.project=$1 AND task.id=$2`, pid, id)
+	task, err := scanTask(row)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	handleErr(err)
+	if err != nil {
+		return nil
+	}
+
+	details := &TaskDetails{
+		Task:          task,
+		Verifications: make([]TaskVerification, 0),
+		Attempts:      make([]TaskAttempt, 0),
+		Dependencies:  make([]int64, 0),
+	}
+
+	rows, err := db.Query(`SELECT worker, verification_hash FROM worker_verifies_task 
+		WHERE task=$1`, id)
+	handleErr(err)
+	if err == nil {
+		for rows.Next() {
+			verification := TaskVerification{}
+			err := rows.Scan(&verification.Worker, &verification.VerificationHash)
+			handleErr(err)
+			details.Verifications = append(details.Verifications, verification)
+		}
+		_ = rows.Close()
+	}
+
+	rows, err = db.Query(`SELECT worker, result, message, COALESCE(details, ''), timestamp 
+		FROM task_attempt WHERE task=$1 ORDER BY id`, id)
+	handleErr(err)
+	if err == nil {
+		for rows.Next() {
+			attempt := TaskAttempt{}
+			var attemptDetails string
+			err := rows.Scan(&attempt.Worker, &attempt.Result, &attempt.Message,
+				&attemptDetails, &attempt.Timestamp)
+			handleErr(err)
+			if attemptDetails != "" {
+				attempt.Details = json.RawMessage(attemptDetails)
+			}
+			details.Attempts = append(details.Attempts, attempt)
+		}
+		_ = rows.Close()
+	}
+
+	rows, err = db.Query(`SELECT parent FROM task_dependency WHERE task=$1 ORDER BY parent`, id)
+	handleErr(err)
+	if err == nil {
+		for rows.Next() {
+			var parent int64
+			err := rows.Scan(&parent)
+			handleErr(err)
+			details.Dependencies = append(details.Dependencies, parent)
+		}
+		_ = rows.Close()
+	}
 
-	task.Project = database.GetProject(projectId)
+	logrus.WithFields(logrus.Fields{
+		"project": pid,
+		"task":    id,
+	}).Trace("Database.GetTaskDetails")
 
-	return task
+	return details
 }
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 )
 
@@ -10,6 +11,14 @@ type Worker struct {
 	Alias   string `json:"alias,omitempty"`
 	Secret  []byte `json:"secret"`
 	Paused  bool   `json:"paused"`
+
+	// A worker is only assigned the tasks whose required tags are all in this list
+	Tags []string `json:"tags"`
+
+	// Tasks assigned at the same time across all projects, 0 to use the project's default
+	MaxConcurrentTasks int64 `json:"max_concurrent_tasks"`
+
+	Reputation float64 `json:"reputation"`
 }
 
 type WorkerStats struct {
@@ -17,8 +26,16 @@ type WorkerStats struct {
 	ClosedTaskCount int64  `json:"closed_task_count"`
 	Paused          bool   `json:"paused"`
 	Id              int64  `json:"id"`
+
+	ReleasedOkCount   int64   `json:"released_ok_count"`
+	ReleasedFailCount int64   `json:"released_fail_count"`
+	Reputation        float64 `json:"reputation"`
 }
 
+// See worker_reputation() in schema.sql
+const workerReputation = `worker_reputation(worker.verification_votes, worker.verification_agreements,
+	worker.released_ok_count, worker.released_fail_count)`
+
 type WorkerAccess struct {
 	Submit  bool   `json:"submit"`
 	Assign  bool   `json:"assign"`
@@ -31,11 +48,11 @@ func (database *Database) SaveWorker(worker *Worker) {
 
 	db := database.getDB()
 
-	row := db.QueryRow(`INSERT INTO worker (created, secret, alias) 
-		VALUES ($1,$2,$3) RETURNING id`,
-		worker.Created, worker.Secret, worker.Alias)
+	row := db.QueryRow(`INSERT INTO worker (created, secret, alias, tags) 
+		VALUES ($1,$2,$3,$4) RETURNING id, `+workerReputation,
+		worker.Created, worker.Secret, worker.Alias, pq.Array(makeTagList(worker.Tags)))
 
-	err := row.Scan(&worker.Id)
+	err := row.Scan(&worker.Id, &worker.Reputation)
 	handleErr(err)
 
 	logrus.WithFields(logrus.Fields{
@@ -53,8 +70,10 @@ func (database *Database) GetWorker(id int64) *Worker {
 
 	worker := &Worker{}
 
-	row := db.QueryRow("SELECT id, created, secret, alias FROM worker WHERE id=$1", id)
-	err := row.Scan(&worker.Id, &worker.Created, &worker.Secret, &worker.Alias)
+	row := db.QueryRow(`SELECT id, created, secret, alias, paused, tags, max_concurrent_tasks, `+workerReputation+`
+		FROM worker WHERE id=$1`, id)
+	err := row.Scan(&worker.Id, &worker.Created, &worker.Secret, &worker.Alias, &worker.Paused,
+		pq.Array(&worker.Tags), &worker.MaxConcurrentTasks, &worker.Reputation)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"id": id,
@@ -74,8 +93,9 @@ func (database *Database) GetWorker(id int64) *Worker {
 func (database *Database) UpdateWorker(worker *Worker) bool {
 
 	db := database.getDB()
-	res, err := db.Exec(`UPDATE worker SET alias=$1, paused=$2 WHERE id=$3`,
-		worker.Alias, worker.Paused, worker.Id)
+	res, err := db.Exec(`UPDATE worker SET alias=$1, paused=$2, tags=$3, max_concurrent_tasks=$4 
+		WHERE id=$5`,
+		worker.Alias, worker.Paused, pq.Array(makeTagList(worker.Tags)), worker.MaxConcurrentTasks, worker.Id)
 	handleErr(err)
 
 	rowsAffected, _ := res.RowsAffected()
@@ -90,6 +110,43 @@ func (database *Database) UpdateWorker(worker *Worker) bool {
 	return rowsAffected == 1
 }
 
+// Workers are cached, but their reputation changes with every release
+func (database *Database) GetWorkerReputation(workerId int64) float64 {
+
+	db := database.getDB()
+
+	var reputation float64
+	err := db.QueryRow(`SELECT `+workerReputation+` FROM worker WHERE id=$1`, workerId).Scan(&reputation)
+	handleErr(err)
+
+	return reputation
+}
+
+// Number of tasks currently assigned to the worker, in all projects
+func (database *Database) GetAssignedTaskCount(workerId int64) int64 {
+
+	db := database.getDB()
+
+	var count int64
+	err := db.QueryRow(`SELECT COUNT(*) FROM task WHERE assignee=$1`, workerId).Scan(&count)
+	handleErr(err)
+
+	logrus.WithFields(logrus.Fields{
+		"worker": workerId,
+		"count":  count,
+	}).Trace("Database.GetAssignedTaskCount")
+
+	return count
+}
+
+// pq.Array() of a nil slice is NULL, tag columns are NOT NULL
+func makeTagList(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
 func (database *Database) SaveAccessRequest(wa *WorkerAccess) bool {
 
 	db := database.getDB()
@@ -177,8 +234,9 @@ func (database *Database) GetAllAccesses(projectId int64) *[]WorkerAccess {
 func (database *Database) GetAllWorkerStats() *[]WorkerStats {
 
 	db := database.getDB()
-	rows, err := db.Query(`SELECT alias, closed_task_count, paused, worker.id 
-		FROM worker`)
+	rows, err := db.Query(`SELECT alias, closed_task_count, paused, worker.id,
+		released_ok_count, released_fail_count, ` +
+		workerReputation + ` FROM worker`)
 
 	handleErr(err)
 	if err != nil {
@@ -188,7 +246,8 @@ func (database *Database) GetAllWorkerStats() *[]WorkerStats {
 	stats := make([]WorkerStats, 0)
 	for rows.Next() {
 		s := WorkerStats{}
-		_ = rows.Scan(&s.Alias, &s.ClosedTaskCount, &s.Paused, &s.Id)
+		_ = rows.Scan(&s.Alias, &s.ClosedTaskCount, &s.Paused, &s.Id,
+			&s.ReleasedOkCount, &s.ReleasedFailCount, &s.Reputation)
 		stats = append(stats, s)
 	}
 
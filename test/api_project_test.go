@@ -482,7 +482,7 @@ func TestPausedProjectShouldNotDispatchTasks(t *testing.T) {
 	}, testWorker)
 
 	task1 := getTaskFromProject(testProject, testWorker).Content.Task
-	if task1 == nil {
+	if task1.Id == 0 {
 		t.Error()
 	}
 
@@ -492,7 +492,7 @@ func TestPausedProjectShouldNotDispatchTasks(t *testing.T) {
 	}, testProject, testAdminCtx)
 
 	task2 := getTaskFromProject(testProject, testWorker).Content.Task
-	if task2 != nil {
+	if task2.Id != 0 {
 		t.Error()
 	}
 
@@ -650,10 +650,189 @@ func TestTaskChainUpdateRequiresRole(t *testing.T) {
 	}
 }
 
+func TestTaskChainCycle(t *testing.T) {
+
+	p1 := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskchaincycle1",
+		CloneUrl: "testtaskchaincycle1",
+	}).Content.Id
+	p2 := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskchaincycle2",
+		CloneUrl: "testtaskchaincycle2",
+		Chains:   []storage.ProjectChain{{Target: p1}},
+	}).Content.Id
+	p3 := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskchaincycle3",
+		CloneUrl: "testtaskchaincycle3",
+		Chain:    p2,
+	}).Content.Id
+
+	resp := updateProject(api.UpdateProjectRequest{
+		Name:     "testtaskchaincycle1",
+		CloneUrl: "testtaskchaincycle1",
+		Chains:   []storage.ProjectChain{{Target: p3}},
+	}, p1, testAdminCtx)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+	if len(resp.Message) <= 0 {
+		t.Error()
+	}
+
+	if len(getProjectAsAdmin(p2).Content.Project.Chains) != 1 {
+		t.Error()
+	}
+}
+
+func TestTaskChainInvalid(t *testing.T) {
+
+	p1 := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskchaininvalid",
+		CloneUrl: "testtaskchaininvalid",
+	}).Content.Id
+
+	resp := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskchaininvalid1",
+		CloneUrl: "testtaskchaininvalid1",
+		Chains: []storage.ProjectChain{
+			{Target: p1, Fields: []string{"a"}, Template: "{{a}}"},
+		},
+	})
+
+	if resp.Ok != false {
+		t.Error()
+	}
+
+	resp = createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskchaininvalid2",
+		CloneUrl: "testtaskchaininvalid2",
+		Chain:    p1,
+		Chains:   []storage.ProjectChain{{Target: p1}},
+	})
+
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
 func TestGetAccessList(t *testing.T) {
 	//TODO!
 }
 
+func TestCreateProjectInvalidRetryPolicy(t *testing.T) {
+
+	r := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:          "testinvalidretrypolicy",
+		GitRepo:       "testinvalidretrypolicy",
+		CloneUrl:      "testinvalidretrypolicy",
+		RetryDelay:    60,
+		RetryMaxDelay: 30,
+	})
+
+	if r.Ok != false {
+		t.Error()
+	}
+
+	r2 := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:            "testinvalidretrypolicy2",
+		GitRepo:         "testinvalidretrypolicy2",
+		CloneUrl:        "testinvalidretrypolicy2",
+		RetryMultiplier: 0.5,
+	})
+
+	if r2.Ok != false {
+		t.Error()
+	}
+}
+
+func TestUpdateProjectKeepsOmittedSettings(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:                      "testupdateprojectomitted",
+		GitRepo:                   "testupdateprojectomitted",
+		CloneUrl:                  "testupdateprojectomitted",
+		RetryDelay:                60,
+		RetryMultiplier:           2,
+		RetryMaxDelay:             600,
+		Chains:                    []storage.ProjectChain{{Target: testProject}},
+		AssignStrategy:            storage.ASSIGN_FIFO,
+		MaxInFlightPerGroup:       2,
+		DefaultMaxConcurrentTasks: 5,
+		DedupMode:                 storage.DEDUP_TTL,
+		DedupTtl:                  3600,
+		MinReputation:             0.25,
+		TrustedReputation:         0.75,
+		TrustedVerificationCount:  1,
+		MaxVerificationAttempts:   3,
+		KeepCompletedTasks:        true,
+		ArchiveTasks:              true,
+	}).Content.Id
+
+	resp := updateProject(api.UpdateProjectRequest{
+		Name:     "testupdateprojectomitted",
+		GitRepo:  "testupdateprojectomitted",
+		CloneUrl: "testupdateprojectomitted",
+	}, pid, testAdminCtx)
+
+	if resp.Ok != true {
+		t.Error()
+	}
+
+	proj := getProjectAsAdmin(pid).Content.Project
+	if proj.RetryDelay != 60 || proj.RetryMultiplier != 2 || proj.RetryMaxDelay != 600 {
+		t.Error()
+	}
+	if len(proj.Chains) != 1 || proj.Chains[0].Target != testProject {
+		t.Error()
+	}
+	if proj.AssignStrategy != storage.ASSIGN_FIFO {
+		t.Error()
+	}
+	if proj.MaxInFlightPerGroup != 2 {
+		t.Error()
+	}
+	if proj.DefaultMaxConcurrentTasks != 5 {
+		t.Error()
+	}
+	if proj.DedupMode != storage.DEDUP_TTL || proj.DedupTtl != 3600 {
+		t.Error()
+	}
+	if proj.MinReputation != 0.25 || proj.TrustedReputation != 0.75 || proj.TrustedVerificationCount != 1 {
+		t.Error()
+	}
+	if proj.MaxVerificationAttempts != 3 {
+		t.Error()
+	}
+	if proj.KeepCompletedTasks != true {
+		t.Error()
+	}
+	if proj.ArchiveTasks != true {
+		t.Error()
+	}
+
+	retryDelay := int64(0)
+	resp = updateProject(api.UpdateProjectRequest{
+		Name:       "testupdateprojectomitted",
+		GitRepo:    "testupdateprojectomitted",
+		CloneUrl:   "testupdateprojectomitted",
+		RetryDelay: &retryDelay,
+		Chains:     []storage.ProjectChain{},
+	}, pid, testAdminCtx)
+
+	if resp.Ok != true {
+		t.Error()
+	}
+
+	proj = getProjectAsAdmin(pid).Content.Project
+	if proj.RetryDelay != 0 || proj.RetryMultiplier != 2 || proj.RetryMaxDelay != 600 {
+		t.Error()
+	}
+	if len(proj.Chains) != 0 {
+		t.Error()
+	}
+}
+
 func createProjectAsAdmin(req api.CreateProjectRequest) CreateProjectAR {
 	return createProject(req, testAdminCtx)
 }
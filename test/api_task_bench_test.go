@@ -65,6 +65,6 @@ func BenchmarkCreateTask(b *testing.B) {
 			Priority:   0,
 			Recipe:     "{}",
 			MaxRetries: 1,
-		}, resp.Content.Id, 0, worker.Id)
+		}, resp.Content.Id, 0, worker.Id, nil)
 	}
 }
@@ -5,8 +5,12 @@ import (
 	"github.com/simon987/task_tracker/api"
 	"github.com/simon987/task_tracker/client"
 	"github.com/simon987/task_tracker/storage"
+	"io/ioutil"
 	"math"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateTaskValid(t *testing.T) {
@@ -179,7 +183,7 @@ func TestCreateGetTask(t *testing.T) {
 	if string(taskResp.Task.Recipe) != "{\"url\":\"test\"}" {
 		t.Error()
 	}
-	if taskResp.Task.Status != 1 {
+	if taskResp.Task.Status != storage.ASSIGNED {
 		t.Error()
 	}
 	if taskResp.Task.MaxRetries != 3 {
@@ -331,7 +335,7 @@ func TestTaskNoAccess(t *testing.T) {
 	if len(tResp.Message) <= 0 {
 		t.Error()
 	}
-	if tResp.Content.Task != nil {
+	if tResp.Content.Task.Id != 0 {
 		t.Error()
 	}
 }
@@ -374,7 +378,7 @@ func TestTaskHasAccess(t *testing.T) {
 	if tResp.Ok != true {
 		t.Error()
 	}
-	if tResp.Content.Task == nil {
+	if tResp.Content.Task.Id == 0 {
 		t.Error()
 	}
 }
@@ -747,7 +751,113 @@ func TestTaskChain(t *testing.T) {
 	if chained.Priority != t1.Priority {
 		t.Error()
 	}
-	if chained.Status != storage.NEW {
+	if chained.Status != storage.ASSIGNED {
+		t.Error()
+	}
+}
+
+func TestTaskChainFanOut(t *testing.T) {
+
+	w := genWid()
+
+	parser := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskchainfanoutparser",
+		GitRepo:  "testtaskchainfanoutparser",
+		CloneUrl: "testtaskchainfanoutparser",
+	}).Content.Id
+	archiver := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskchainfanoutarchiver",
+		GitRepo:  "testtaskchainfanoutarchiver",
+		CloneUrl: "testtaskchainfanoutarchiver",
+	}).Content.Id
+
+	priority := int16(5)
+	crawler := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskchainfanoutcrawler",
+		GitRepo:  "testtaskchainfanoutcrawler",
+		CloneUrl: "testtaskchainfanoutcrawler",
+		Chains: []storage.ProjectChain{
+			{Target: parser, Priority: &priority, Fields: []string{"url"}},
+			{Target: archiver, Template: "archive {{url}}"},
+		},
+	}).Content.Id
+
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: crawler,
+		Assign:  true,
+		Submit:  true,
+	}, w)
+	acceptAccessRequest(crawler, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project: crawler,
+		Recipe:  `{"url": "http://example.com", "depth": 2}`,
+	}, w)
+
+	task := getTaskFromProject(crawler, w).Content.Task
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_OK,
+	}, w)
+
+	parsed := getTasks(api.GetTasksRequest{Count: 10}, parser, testAdminCtx).Content.Tasks
+	if len(parsed) != 1 {
+		t.Error()
+	}
+	if parsed[0].Recipe != `{"url": "http://example.com"}` || parsed[0].Priority != 5 {
+		t.Error()
+	}
+
+	archived := getTasks(api.GetTasksRequest{Count: 10}, archiver, testAdminCtx).Content.Tasks
+	if len(archived) != 1 {
+		t.Error()
+	}
+	if archived[0].Recipe != "archive http://example.com" || archived[0].Priority != 0 {
+		t.Error()
+	}
+}
+
+func TestTaskChainNotJsonRecipe(t *testing.T) {
+
+	w := genWid()
+
+	parser := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskchainnotjsonparser",
+		GitRepo:  "testtaskchainnotjsonparser",
+		CloneUrl: "testtaskchainnotjsonparser",
+	}).Content.Id
+	crawler := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskchainnotjsoncrawler",
+		GitRepo:  "testtaskchainnotjsoncrawler",
+		CloneUrl: "testtaskchainnotjsoncrawler",
+		Chains: []storage.ProjectChain{
+			{Target: parser, Fields: []string{"url"}},
+		},
+	}).Content.Id
+
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: crawler,
+		Assign:  true,
+		Submit:  true,
+	}, w)
+	acceptAccessRequest(crawler, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project: crawler,
+		Recipe:  `{"url": "http://example.com"`,
+	}, w)
+
+	task := getTaskFromProject(crawler, w).Content.Task
+	resp := releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_OK,
+	}, w)
+	if resp.Content.Updated != true {
+		t.Error()
+	}
+
+	parsed := getTasks(api.GetTasksRequest{Count: 10}, parser, testAdminCtx).Content.Tasks
+	if len(parsed) != 1 || parsed[0].Recipe != `{"url": "http://example.com"` {
 		t.Error()
 	}
 }
@@ -1000,6 +1110,135 @@ func TestBulkTaskSubmitInvalid(t *testing.T) {
 	}
 }
 
+func TestBulkTaskSubmitResults(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testbulktasksubmitresults",
+		CloneUrl: "testbulktasksubmitresults",
+		GitRepo:  "testbulktasksubmitresults",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project:      pid,
+		Recipe:       "existing",
+		UniqueString: "existing",
+	}, w)
+
+	var bulkResp BulkSubmitTaskAR
+	r := Post("/task/bulk_submit", api.BulkSubmitTaskRequest{
+		Requests: []api.SubmitTaskRequest{
+			{Project: pid, Recipe: "a", UniqueString: "a"},
+			{Project: pid, Recipe: "existing", UniqueString: "existing"},
+			{Project: pid, Recipe: "", UniqueString: "empty"},
+			{Project: pid, Recipe: "a again", UniqueString: "a"},
+			{Project: pid, Recipe: "no hash"},
+			{Project: pid, Recipe: "with tags", RequiredTags: []string{"x", "y"}},
+		},
+	}, w, nil)
+	UnmarshalResponse(r, &bulkResp)
+
+	if bulkResp.Ok != true || len(bulkResp.Content.Results) != 6 {
+		t.Error()
+		return
+	}
+
+	results := bulkResp.Content.Results
+	for i, status := range []api.SubmitStatus{api.SUBMIT_INSERTED, api.SUBMIT_DUPLICATE,
+		api.SUBMIT_INVALID, api.SUBMIT_DUPLICATE, api.SUBMIT_INSERTED, api.SUBMIT_INSERTED} {
+		if results[i].Status != status {
+			t.Error()
+		}
+	}
+	if results[0].Id == 0 || results[4].Id == 0 || results[1].Id != 0 {
+		t.Error()
+	}
+
+	details := getTaskDetails(pid, results[5].Id, testAdminCtx).Content.Details.Task
+	if details.Recipe != "with tags" || len(details.RequiredTags) != 2 {
+		t.Error()
+	}
+	if getTaskDetails(pid, results[0].Id, testAdminCtx).Content.Details.Task.Recipe != "a" {
+		t.Error()
+	}
+}
+
+func TestBulkTaskSubmitResultsCompletedAndInvalid(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:         "testbulktasksubmitresultscompleted",
+		CloneUrl:     "testbulktasksubmitresultscompleted",
+		GitRepo:      "testbulktasksubmitresultscompleted",
+		DedupMode:    storage.DEDUP_FOREVER,
+		RecipeSchema: `{"type":"object","required":["url"]}`,
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project:      pid,
+		Recipe:       `{"url":"done"}`,
+		UniqueString: "done",
+	}, w)
+	task := getTaskFromProject(pid, w).Content.Task
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_OK,
+	}, w)
+
+	var bulkResp BulkSubmitTaskAR
+	r := Post("/task/bulk_submit", api.BulkSubmitTaskRequest{
+		Requests: []api.SubmitTaskRequest{
+			{Project: pid, Recipe: `{"url":"a"}`, UniqueString: "a"},
+			{Project: pid, Recipe: `{"url":"done"}`, UniqueString: "done"},
+			{Project: pid, Recipe: `{"path":"b"}`, UniqueString: "b"},
+			{Project: pid, Recipe: `{"url":"c"}`, UniqueString: "c"},
+			{Project: pid, Recipe: `{"url":"done again"}`, UniqueString: "done"},
+		},
+	}, w, nil)
+	UnmarshalResponse(r, &bulkResp)
+
+	if bulkResp.Ok != true || len(bulkResp.Content.Results) != 5 {
+		t.Error()
+		return
+	}
+
+	results := bulkResp.Content.Results
+	for i, status := range []api.SubmitStatus{api.SUBMIT_INSERTED, api.SUBMIT_RECENTLY_COMPLETED,
+		api.SUBMIT_INVALID, api.SUBMIT_INSERTED, api.SUBMIT_RECENTLY_COMPLETED} {
+		if results[i].Status != status {
+			t.Error()
+		}
+	}
+	for _, i := range []int{1, 2, 4} {
+		if results[i].Id != 0 || results[i].Message == "" {
+			t.Error()
+		}
+	}
+	if !strings.Contains(results[2].Message, "url") {
+		t.Error()
+	}
+	if getTaskDetails(pid, results[0].Id, testAdminCtx).Content.Details.Task.Recipe != `{"url":"a"}` {
+		t.Error()
+	}
+	if getTaskDetails(pid, results[3].Id, testAdminCtx).Content.Details.Task.Recipe != `{"url":"c"}` {
+		t.Error()
+	}
+}
+
 func TestBulkTaskSubmitInvalid2(t *testing.T) {
 
 	r := bulkSubmitTask(api.BulkSubmitTaskRequest{
@@ -1049,32 +1288,2571 @@ func TestTaskGetUnauthorizedWithCache(t *testing.T) {
 	}
 }
 
-func bulkSubmitTask(request api.BulkSubmitTaskRequest, worker *storage.Worker) (ar api.JsonResponse) {
-	r := Post("/task/bulk_submit", request, worker, nil)
-	UnmarshalResponse(r, &ar)
-	return
+func TestBulkGetTasks(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testbulkgettasks",
+		GitRepo:  "testbulkgettasks",
+		CloneUrl: "testbulkgettasks",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	for i := 0; i < 3; i++ {
+		createTask(api.SubmitTaskRequest{
+			Project: pid,
+			Recipe:  "bulkget",
+		}, w)
+	}
+
+	resp := getTasksFromProject(pid, 2, w)
+
+	if resp.Ok != true {
+		t.Error()
+	}
+	if len(resp.Content.Tasks) != 2 {
+		t.Error()
+	}
+	for _, task := range resp.Content.Tasks {
+		if task.Assignee != w.Id {
+			t.Error()
+		}
+		if task.Project.Id != pid {
+			t.Error()
+		}
+	}
+
+	resp2 := getTasksFromProject(pid, 10, w)
+
+	if len(resp2.Content.Tasks) != 1 {
+		t.Error()
+	}
+
+	resp3 := getTasksFromProject(pid, 10, w)
+
+	if resp3.Ok != false {
+		t.Error()
+	}
 }
 
-func createTask(request api.SubmitTaskRequest, worker *storage.Worker) (ar api.JsonResponse) {
-	r := Post("/task/submit", request, worker, nil)
-	UnmarshalResponse(r, &ar)
-	return
+func TestBulkGetTasksInvalidCount(t *testing.T) {
+
+	resp := getTasksFromProject(testProject, 0, testWorker)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+
+	resp2 := getTasksFromProject(testProject, api.MaxBulkGetCount+1, testWorker)
+
+	if resp2.Ok != false {
+		t.Error()
+	}
 }
 
-func getTask(worker *storage.Worker) (ar client.AssignTaskResponse) {
-	r := Get("/task/get", worker, nil)
-	UnmarshalResponse(r, &ar)
-	return
+func TestBulkReleaseTask(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testbulkreleasetask",
+		GitRepo:  "testbulkreleasetask",
+		CloneUrl: "testbulkreleasetask",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	for i := 0; i < 3; i++ {
+		createTask(api.SubmitTaskRequest{
+			Project:    pid,
+			Recipe:     "bulkrelease",
+			MaxRetries: 3,
+		}, w)
+	}
+
+	tasks := getTasksFromProject(pid, 3, w).Content.Tasks
+
+	resp := bulkReleaseTask(api.BulkReleaseTaskRequest{
+		Requests: []api.ReleaseTaskRequest{
+			{TaskId: tasks[0].Id, Result: storage.TR_OK},
+			{TaskId: tasks[1].Id, Result: storage.TR_FAIL},
+			{TaskId: tasks[2].Id, Result: storage.TR_SKIP},
+			{TaskId: 0, Result: storage.TR_OK},
+			{TaskId: tasks[0].Id, Result: storage.TR_OK},
+		},
+	}, w)
+
+	if resp.Ok != true {
+		t.Error()
+	}
+	if len(resp.Content.Results) != 5 {
+		t.Fatal()
+	}
+	for i := 0; i < 3; i++ {
+		if resp.Content.Results[i].Updated != true {
+			t.Error()
+		}
+		if resp.Content.Results[i].TaskId != tasks[i].Id {
+			t.Error()
+		}
+	}
+	if resp.Content.Results[3].Updated != false {
+		t.Error()
+	}
+	if resp.Content.Results[4].Updated != false {
+		t.Error()
+	}
+	if len(resp.Content.Results[4].Message) <= 0 {
+		t.Error()
+	}
+
+	remaining := getTasksFromProject(pid, 3, w).Content.Tasks
+	if len(remaining) != 2 {
+		t.Error()
+	}
 }
 
-func getTaskFromProject(project int64, worker *storage.Worker) (ar client.AssignTaskResponse) {
-	r := Get(fmt.Sprintf("/task/get/%d", project), worker, nil)
-	UnmarshalResponse(r, &ar)
-	return
+func TestBulkReleaseTaskEmpty(t *testing.T) {
+
+	resp := bulkReleaseTask(api.BulkReleaseTaskRequest{}, testWorker)
+
+	if resp.Ok != false {
+		t.Error()
+	}
 }
 
-func releaseTask(request api.ReleaseTaskRequest, worker *storage.Worker) (ar client.ReleaseTaskResponse) {
-	r := Post("/task/release", request, worker, nil)
-	UnmarshalResponse(r, &ar)
-	return
+func TestBulkReleaseTaskTooMany(t *testing.T) {
+
+	reqs := make([]api.ReleaseTaskRequest, api.MaxBulkReleaseCount+1)
+	for i := range reqs {
+		reqs[i] = api.ReleaseTaskRequest{TaskId: int64(i + 1), Result: storage.TR_OK}
+	}
+
+	resp := bulkReleaseTask(api.BulkReleaseTaskRequest{Requests: reqs}, testWorker)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestGetTaskFromAnyProject(t *testing.T) {
+
+	low := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testgettaskanylow",
+		GitRepo:  "testgettaskanylow",
+		CloneUrl: "testgettaskanylow",
+		Priority: 0,
+	}).Content.Id
+	high := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testgettaskanyhigh",
+		GitRepo:  "testgettaskanyhigh",
+		CloneUrl: "testgettaskanyhigh",
+		Priority: 10000000,
+	}).Content.Id
+
+	w := genWid()
+	for _, pid := range []int64{low, high} {
+		requestAccess(api.CreateWorkerAccessRequest{
+			Project: pid,
+			Submit:  true,
+			Assign:  true,
+		}, w)
+		acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+		createTask(api.SubmitTaskRequest{
+			Project: pid,
+			Recipe:  "any",
+		}, w)
+	}
+
+	t1 := getTask(w)
+	if t1.Ok != true {
+		t.Error()
+	}
+	if t1.Content.Task.Project.Id != high {
+		t.Error()
+	}
+
+	updateProject(api.UpdateProjectRequest{
+		Name:     "testgettaskanylow",
+		GitRepo:  "testgettaskanylow",
+		CloneUrl: "testgettaskanylow",
+		Priority: 0,
+		Paused:   true,
+	}, low, testAdminCtx)
+
+	t2 := getTask(w)
+	if t2.Ok == true && t2.Content.Task.Project.Id == low {
+		t.Error()
+	}
+}
+
+func TestGetTaskFromAnyProjectNoStarvation(t *testing.T) {
+
+	var pids []int64
+	for _, name := range []string{"testgettaskanyfair1", "testgettaskanyfair2"} {
+		pids = append(pids, createProjectAsAdmin(api.CreateProjectRequest{
+			Name:     name,
+			GitRepo:  name,
+			CloneUrl: name,
+			Priority: 10000000,
+		}).Content.Id)
+	}
+
+	w := genWid()
+	for _, pid := range pids {
+		requestAccess(api.CreateWorkerAccessRequest{
+			Project: pid,
+			Submit:  true,
+			Assign:  true,
+		}, w)
+		acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+		for i := 0; i < 20; i++ {
+			createTask(api.SubmitTaskRequest{
+				Project: pid,
+				Recipe:  fmt.Sprintf("fair%d", i),
+			}, w)
+		}
+	}
+
+	assigned := make(map[int64]int)
+	for i := 0; i < 20; i++ {
+		resp := getTask(w)
+		if resp.Ok != true {
+			t.Error()
+			continue
+		}
+		assigned[resp.Content.Task.Project.Id]++
+	}
+
+	if assigned[pids[0]] == 0 || assigned[pids[1]] == 0 {
+		t.Error()
+	}
+}
+
+func TestGetTaskWait(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testgettaskwait",
+		GitRepo:  "testgettaskwait",
+		CloneUrl: "testgettaskwait",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	go func() {
+		time.Sleep(time.Millisecond * 500)
+		createTask(api.SubmitTaskRequest{
+			Project: pid,
+			Recipe:  "wait",
+		}, w)
+	}()
+
+	start := time.Now()
+	resp := getTaskFromProjectWait(pid, 10, w)
+
+	if resp.Ok != true {
+		t.Error()
+	}
+	if time.Since(start) >= time.Second*10 {
+		t.Error()
+	}
+}
+
+func TestGetTaskWaitNotBefore(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testgettaskwaitnotbefore",
+		GitRepo:  "testgettaskwaitnotbefore",
+		CloneUrl: "testgettaskwaitnotbefore",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project:   pid,
+		Recipe:    "waitnotbefore",
+		NotBefore: time.Now().Unix() + 2,
+	}, w)
+
+	start := time.Now()
+	resp := getTaskFromProjectWait(pid, 10, w)
+
+	if resp.Ok != true {
+		t.Error()
+	}
+	if time.Since(start) >= time.Second*10 {
+		t.Error()
+	}
+}
+
+func TestGetTaskWaitTimeout(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testgettaskwaittimeout",
+		GitRepo:  "testgettaskwaittimeout",
+		CloneUrl: "testgettaskwaittimeout",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	start := time.Now()
+	resp := getTaskFromProjectWait(pid, 1, w)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+	if time.Since(start) < time.Second {
+		t.Error()
+	}
+}
+
+func TestGetTaskWaitInvalid(t *testing.T) {
+
+	resp := getTaskFromProjectWait(testProject, api.MaxWait+1, testWorker)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestTaskHeartbeat(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskheartbeat",
+		GitRepo:  "testtaskheartbeat",
+		CloneUrl: "testtaskheartbeat",
+	}).Content.Id
+
+	w := genWid()
+	w2 := genWid()
+	for _, worker := range []*storage.Worker{w, w2} {
+		requestAccess(api.CreateWorkerAccessRequest{
+			Project: pid,
+			Submit:  true,
+			Assign:  true,
+		}, worker)
+		acceptAccessRequest(pid, worker.Id, testAdminCtx)
+	}
+
+	createTask(api.SubmitTaskRequest{
+		Project:       pid,
+		Recipe:        "heartbeat",
+		MaxAssignTime: 3600,
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+	if task.LeaseRemaining != 3600 {
+		t.Error()
+	}
+
+	resp := taskHeartbeat(api.TaskHeartbeatRequest{
+		TaskId: task.Id,
+	}, w)
+
+	if resp.Ok != true {
+		t.Error()
+	}
+	if resp.Content.LeaseRemaining != 3600 {
+		t.Error()
+	}
+
+	details := getTaskDetails(pid, task.Id, testAdminCtx)
+	if details.Content.Details.Task.LeaseRemaining <= 0 ||
+		details.Content.Details.Task.LeaseRemaining > 3600 {
+		t.Error()
+	}
+
+	resp2 := taskHeartbeat(api.TaskHeartbeatRequest{
+		TaskId: task.Id,
+	}, w2)
+
+	if resp2.Ok != false {
+		t.Error()
+	}
+}
+
+func TestBulkTaskHeartbeat(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testbulktaskheartbeat",
+		GitRepo:  "testbulktaskheartbeat",
+		CloneUrl: "testbulktaskheartbeat",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project:       pid,
+		Recipe:        "heartbeat",
+		MaxAssignTime: 60,
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	var resp BulkTaskHeartbeatAR
+	r := Post("/task/bulk_heartbeat", api.BulkTaskHeartbeatRequest{
+		TaskIds: []int64{task.Id, 9999999},
+	}, w, nil)
+	UnmarshalResponse(r, &resp)
+
+	if resp.Ok != true {
+		t.Error()
+	}
+	if len(resp.Content.Leases) != 2 {
+		t.Fatal()
+	}
+	if resp.Content.Leases[0].Updated != true || resp.Content.Leases[0].LeaseRemaining != 60 {
+		t.Error()
+	}
+	if resp.Content.Leases[1].Updated != false {
+		t.Error()
+	}
+
+	var resp2 BulkTaskHeartbeatAR
+	r = Post("/task/bulk_heartbeat", api.BulkTaskHeartbeatRequest{
+		TaskIds: make([]int64, api.MaxBulkHeartbeatCount+1),
+	}, w, nil)
+	UnmarshalResponse(r, &resp2)
+
+	if resp2.Ok != false {
+		t.Error()
+	}
+}
+
+func TestTaskProgressCheckpoint(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskprogress",
+		GitRepo:  "testtaskprogress",
+		CloneUrl: "testtaskprogress",
+	}).Content.Id
+
+	w := genWid()
+	w2 := genWid()
+	for _, worker := range []*storage.Worker{w, w2} {
+		requestAccess(api.CreateWorkerAccessRequest{
+			Project: pid,
+			Submit:  true,
+			Assign:  true,
+		}, worker)
+		acceptAccessRequest(pid, worker.Id, testAdminCtx)
+	}
+
+	createTask(api.SubmitTaskRequest{
+		Project:    pid,
+		Recipe:     "progress",
+		MaxRetries: 3,
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	if taskProgress(api.TaskProgressRequest{
+		TaskId:     task.Id,
+		Progress:   50,
+		Checkpoint: "{\"page\":12}",
+	}, w2).Ok != false {
+		t.Error()
+	}
+
+	if taskProgress(api.TaskProgressRequest{
+		TaskId:     task.Id,
+		Progress:   50,
+		Checkpoint: "{\"page\":12}",
+	}, w).Ok != true {
+		t.Error()
+	}
+
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_FAIL,
+	}, w)
+
+	resumed := getTaskFromProject(pid, w2).Content.Task
+
+	if resumed.Id != task.Id {
+		t.Error()
+	}
+	if resumed.Progress != 50 {
+		t.Error()
+	}
+	if resumed.Checkpoint != "{\"page\":12}" {
+		t.Error()
+	}
+}
+
+func TestTaskProgressInvalid(t *testing.T) {
+
+	resp := taskProgress(api.TaskProgressRequest{
+		TaskId:   1,
+		Progress: 101,
+	}, testWorker)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+
+	resp2 := taskProgress(api.TaskProgressRequest{
+		TaskId:     1,
+		Progress:   50,
+		Checkpoint: strings.Repeat("a", api.MaxCheckpointLength+1),
+	}, testWorker)
+
+	if resp2.Ok != false {
+		t.Error()
+	}
+}
+
+func TestTaskNotBefore(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtasknotbefore",
+		GitRepo:  "testtasknotbefore",
+		CloneUrl: "testtasknotbefore",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project:   pid,
+		Recipe:    "later",
+		NotBefore: time.Now().Unix() + 3600,
+	}, w)
+
+	if getTaskFromProject(pid, w).Ok != false {
+		t.Error()
+	}
+
+	createTask(api.SubmitTaskRequest{
+		Project:   pid,
+		Recipe:    "now",
+		NotBefore: time.Now().Unix() - 10,
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+	if task.Id == 0 || task.Recipe != "now" {
+		t.Error()
+	}
+}
+
+func TestTaskNotBeforeInvalid(t *testing.T) {
+
+	resp := createTask(api.SubmitTaskRequest{
+		Project:   testProject,
+		Recipe:    "invalid",
+		NotBefore: -1,
+	}, testWorker)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestReleaseTaskFailRetryDelay(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:            "testreleasefailretrydelay",
+		GitRepo:         "testreleasefailretrydelay",
+		CloneUrl:        "testreleasefailretrydelay",
+		RetryDelay:      3600,
+		RetryMultiplier: 2,
+		RetryMaxDelay:   7200,
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project:    pid,
+		Recipe:     "retrydelay",
+		MaxRetries: 3,
+		NotBefore:  1,
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_FAIL,
+	}, w)
+
+	// Task is in backoff
+	if getTaskFromProject(pid, w).Ok != false {
+		t.Error()
+	}
+
+	details := getTaskDetails(pid, task.Id, testAdminCtx).Content.Details
+	if details.Task.NotBefore != 1 {
+		t.Error()
+	}
+	if details.Task.RetryAfter < time.Now().Unix()+3500 {
+		t.Error()
+	}
+}
+
+func TestGetFailedTasks(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testgetfailedtasks",
+		GitRepo:  "testgetfailedtasks",
+		CloneUrl: "testgetfailedtasks",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project:    pid,
+		Recipe:     "failed",
+		MaxRetries: 1,
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	tooLong := releaseTask(api.ReleaseTaskRequest{
+		TaskId:  task.Id,
+		Result:  storage.TR_FAIL,
+		Details: []byte(`"` + strings.Repeat("a", api.MaxReleaseDetailsLength) + `"`),
+	}, w)
+
+	if tooLong.Ok != false {
+		t.Error()
+	}
+
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId:  task.Id,
+		Result:  storage.TR_FAIL,
+		Message: "connection reset",
+		Details: []byte(`{"code":104}`),
+	}, w)
+
+	resp := getFailedTasks(pid, 0, 10, testAdminCtx)
+
+	if resp.Ok != true {
+		t.Error()
+	}
+	if len(resp.Content.Tasks) != 1 {
+		t.Error()
+	}
+	failed := resp.Content.Tasks[0]
+	if failed.Id != task.Id || failed.Recipe != "failed" {
+		t.Error()
+	}
+	if failed.LastAttempt == nil || failed.LastAttempt.Message != "connection reset" {
+		t.Error()
+	}
+	if failed.LastAttempt.Worker != w.Id || failed.LastAttempt.Result != storage.TR_FAIL {
+		t.Error()
+	}
+	if string(failed.LastAttempt.Details) != `{"code":104}` {
+		t.Error()
+	}
+
+	if len(getFailedTasks(pid, task.Id, 10, testAdminCtx).Content.Tasks) != 0 {
+		t.Error()
+	}
+}
+
+func TestGetFailedTasksUnauthorized(t *testing.T) {
+
+	resp := getFailedTasks(testProject, 0, 10, testUserCtx)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+	if len(resp.Message) <= 0 {
+		t.Error()
+	}
+}
+
+func TestReleaseTaskWithOutput(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testreleasetaskwithoutput",
+		GitRepo:  "testreleasetaskwithoutput",
+		CloneUrl: "testreleasetaskwithoutput",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project:    pid,
+		Recipe:     "withoutput",
+		MaxRetries: 1,
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	tooLong := releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_OK,
+		Output: []byte(`"` + strings.Repeat("a", api.MaxReleaseOutputLength) + `"`),
+	}, w)
+
+	if tooLong.Ok != false {
+		t.Error()
+	}
+
+	resp := releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_OK,
+		Output: []byte(`{"title":"hello"}`),
+	}, w)
+
+	if resp.Content.Updated != true {
+		t.Error()
+	}
+
+	results := getResults(pid, 0, 10, testAdminCtx)
+
+	if results.Ok != true {
+		t.Error()
+	}
+	if len(results.Content.Results) != 1 {
+		t.Error()
+	}
+	result := results.Content.Results[0]
+	if result.Task != task.Id || result.Recipe != "withoutput" || result.Worker != w.Id || !result.Closed {
+		t.Error()
+	}
+	if string(result.Output) != `{"title":"hello"}` {
+		t.Error()
+	}
+
+	if len(getResults(pid, result.Id, 10, testAdminCtx).Content.Results) != 0 {
+		t.Error()
+	}
+
+	r := Get(fmt.Sprintf("/project/export_results/%d", pid), nil, testAdminCtx)
+	export, _ := ioutil.ReadAll(r.Body)
+	if !strings.Contains(string(export), `"output":{"title":"hello"}`) {
+		t.Error()
+	}
+}
+
+func TestReleaseTaskWithOutputVerification(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testreleasetaskwithoutputver",
+		GitRepo:  "testreleasetaskwithoutputver",
+		CloneUrl: "testreleasetaskwithoutputver",
+	}).Content.Id
+
+	w1 := genWid()
+	w2 := genWid()
+	for _, w := range []*storage.Worker{w1, w2} {
+		requestAccess(api.CreateWorkerAccessRequest{
+			Project: pid,
+			Submit:  true,
+			Assign:  true,
+		}, w)
+		acceptAccessRequest(pid, w.Id, testAdminCtx)
+	}
+
+	createTask(api.SubmitTaskRequest{
+		Project:           pid,
+		Recipe:            "withoutputver",
+		MaxRetries:        1,
+		VerificationCount: 2,
+	}, w1)
+
+	for _, w := range []*storage.Worker{w1, w2} {
+		task := getTaskFromProject(pid, w).Content.Task
+		releaseTask(api.ReleaseTaskRequest{
+			TaskId:       task.Id,
+			Result:       storage.TR_OK,
+			Verification: 123,
+			Output:       []byte(fmt.Sprintf(`{"worker":%d}`, w.Id)),
+		}, w)
+	}
+
+	results := getResults(pid, 0, 10, testAdminCtx).Content.Results
+
+	if len(results) != 2 {
+		t.Error()
+		return
+	}
+	if results[0].Worker != w1.Id || results[0].Closed != false || results[0].Verification != 123 {
+		t.Error()
+	}
+	if results[1].Worker != w2.Id || results[1].Closed != true || results[1].Verification != 123 {
+		t.Error()
+	}
+}
+
+func TestGetResultsUnauthorized(t *testing.T) {
+
+	resp := getResults(testProject, 0, 10, testUserCtx)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestGetTasksFilter(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testgettasksfilter",
+		GitRepo:  "testgettasksfilter",
+		CloneUrl: "testgettasksfilter",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	for i := 0; i < 5; i++ {
+		createTask(api.SubmitTaskRequest{
+			Project:  pid,
+			Recipe:   fmt.Sprintf("filter%d", i),
+			Priority: int16(i),
+		}, w)
+	}
+
+	minPriority := int16(1)
+	maxPriority := int16(3)
+	resp := getTasks(api.GetTasksRequest{
+		Filter: storage.TaskFilter{
+			MinPriority: &minPriority,
+			MaxPriority: &maxPriority,
+		},
+		Count: 2,
+	}, pid, testAdminCtx)
+
+	if resp.Ok != true {
+		t.Error()
+	}
+	if len(resp.Content.Tasks) != 2 {
+		t.Error()
+	}
+	if resp.Content.Tasks[0].Recipe != "filter1" || resp.Content.Tasks[1].Recipe != "filter2" {
+		t.Error()
+	}
+
+	resp = getTasks(api.GetTasksRequest{
+		Filter: storage.TaskFilter{
+			MinPriority: &minPriority,
+			MaxPriority: &maxPriority,
+		},
+		After: resp.Content.Tasks[1].Id,
+		Count: 2,
+	}, pid, testAdminCtx)
+
+	if len(resp.Content.Tasks) != 1 || resp.Content.Tasks[0].Recipe != "filter3" {
+		t.Error()
+	}
+
+	resp = getTasks(api.GetTasksRequest{
+		Filter: storage.TaskFilter{
+			Recipe: "filter4",
+		},
+		Count: 10,
+	}, pid, testAdminCtx)
+
+	if len(resp.Content.Tasks) != 1 || resp.Content.Tasks[0].Priority != 4 {
+		t.Error()
+	}
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	resp = getTasks(api.GetTasksRequest{
+		Filter: storage.TaskFilter{
+			Assignee: w.Id,
+		},
+		Count: 10,
+	}, pid, testAdminCtx)
+
+	if len(resp.Content.Tasks) != 1 || resp.Content.Tasks[0].Id != task.Id {
+		t.Error()
+	}
+
+	resp = getTasks(api.GetTasksRequest{
+		Filter: storage.TaskFilter{
+			Assignee: -1,
+		},
+		Count: 10,
+	}, pid, testAdminCtx)
+
+	if len(resp.Content.Tasks) != 4 {
+		t.Error()
+	}
+}
+
+func TestGetTasksInvalid(t *testing.T) {
+
+	resp := getTasks(api.GetTasksRequest{
+		Count: 0,
+	}, testProject, testAdminCtx)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+
+	resp = getTasks(api.GetTasksRequest{
+		Count: 10,
+	}, testProject, testUserCtx)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestGetTaskDetails(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testgettaskdetails",
+		GitRepo:  "testgettaskdetails",
+		CloneUrl: "testgettaskdetails",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project:           pid,
+		Recipe:            "details",
+		MaxRetries:        3,
+		VerificationCount: 2,
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId:       task.Id,
+		Result:       storage.TR_OK,
+		Verification: 123,
+	}, w)
+
+	resp := getTaskDetails(pid, task.Id, testAdminCtx)
+
+	if resp.Ok != true {
+		t.Error()
+	}
+	details := resp.Content.Details
+	if details.Task.Recipe != "details" {
+		t.Error()
+	}
+	if len(details.Verifications) != 1 {
+		t.Error()
+	}
+	if details.Verifications[0].Worker != w.Id || details.Verifications[0].VerificationHash != 123 {
+		t.Error()
+	}
+	if len(details.Attempts) != 1 || details.Attempts[0].Result != storage.TR_OK {
+		t.Error()
+	}
+
+	if getTaskDetails(pid, task.Id+1000, testAdminCtx).Ok != false {
+		t.Error()
+	}
+}
+
+func TestEditSingleTask(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testeditsingletask",
+		GitRepo:  "testeditsingletask",
+		CloneUrl: "testeditsingletask",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  "edit1",
+	}, w)
+	createTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  "edit2",
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	resp := editTasks("unassign_task", pid, task.Id, api.EditTasksRequest{}, testAdminCtx)
+	if resp.Ok != true || resp.Content.AffectedTasks != 1 {
+		t.Error()
+	}
+	if getTaskDetails(pid, task.Id, testAdminCtx).Content.Details.Task.Assignee != 0 {
+		t.Error()
+	}
+
+	priority := int16(10)
+	resp = editTasks("update_task", pid, task.Id, api.EditTasksRequest{
+		Priority: &priority,
+	}, testAdminCtx)
+	if resp.Content.AffectedTasks != 1 {
+		t.Error()
+	}
+	if getTaskDetails(pid, task.Id, testAdminCtx).Content.Details.Task.Priority != 10 {
+		t.Error()
+	}
+
+	resp = editTasks("delete_task", pid, task.Id, api.EditTasksRequest{}, testAdminCtx)
+	if resp.Content.AffectedTasks != 1 {
+		t.Error()
+	}
+	if getTaskDetails(pid, task.Id, testAdminCtx).Ok != false {
+		t.Error()
+	}
+	if len(getTasks(api.GetTasksRequest{Count: 10}, pid, testAdminCtx).Content.Tasks) != 1 {
+		t.Error()
+	}
+}
+
+func TestEditTasksBulk(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testedittasksbulk",
+		GitRepo:  "testedittasksbulk",
+		CloneUrl: "testedittasksbulk",
+	}).Content.Id
+	target := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testedittasksbulktarget",
+		GitRepo:  "testedittasksbulktarget",
+		CloneUrl: "testedittasksbulktarget",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	for i := 0; i < 3; i++ {
+		createTask(api.SubmitTaskRequest{
+			Project: pid,
+			Recipe:  fmt.Sprintf("move%d", i),
+		}, w)
+		createTask(api.SubmitTaskRequest{
+			Project: pid,
+			Recipe:  fmt.Sprintf("stay%d", i),
+		}, w)
+	}
+
+	maxRetries := int16(5)
+	resp := editTasks("update_tasks", pid, 0, api.EditTasksRequest{
+		Filter:     storage.TaskFilter{Recipe: "stay"},
+		MaxRetries: &maxRetries,
+	}, testAdminCtx)
+	if resp.Content.AffectedTasks != 3 {
+		t.Error()
+	}
+
+	resp = editTasks("move_tasks", pid, 0, api.EditTasksRequest{
+		Filter:  storage.TaskFilter{Recipe: "move"},
+		Project: target,
+	}, testAdminCtx)
+	if resp.Ok != true || resp.Content.AffectedTasks != 3 {
+		t.Error()
+	}
+	if len(getTasks(api.GetTasksRequest{Count: 10}, target, testAdminCtx).Content.Tasks) != 3 {
+		t.Error()
+	}
+
+	resp = editTasks("delete_tasks", pid, 0, api.EditTasksRequest{
+		Filter: storage.TaskFilter{Recipe: "stay"},
+	}, testAdminCtx)
+	if resp.Content.AffectedTasks != 3 {
+		t.Error()
+	}
+	if len(getTasks(api.GetTasksRequest{Count: 10}, pid, testAdminCtx).Content.Tasks) != 0 {
+		t.Error()
+	}
+}
+
+func TestEditTasksEmptyFilter(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testedittasksemptyfilter",
+		GitRepo:  "testedittasksemptyfilter",
+		CloneUrl: "testedittasksemptyfilter",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	for i := 0; i < 3; i++ {
+		createTask(api.SubmitTaskRequest{
+			Project: pid,
+			Recipe:  fmt.Sprintf("emptyfilter%d", i),
+		}, w)
+	}
+
+	for _, action := range []string{"delete_tasks", "update_tasks", "unassign_tasks", "cancel_tasks"} {
+		resp := editTasks(action, pid, 0, api.EditTasksRequest{}, testAdminCtx)
+		if resp.Ok != false {
+			t.Error()
+		}
+	}
+
+	r := Post(fmt.Sprintf("/project/delete_tasks/%d", pid), nil, nil, testAdminCtx)
+	if r.StatusCode != 400 {
+		t.Error()
+	}
+
+	tasks := getTasks(api.GetTasksRequest{Count: 10}, pid, testAdminCtx).Content.Tasks
+	if len(tasks) != 3 {
+		t.Error()
+	}
+	for _, task := range tasks {
+		if task.Status != storage.NEW {
+			t.Error()
+		}
+	}
+}
+
+func TestEditTasksUnauthorized(t *testing.T) {
+
+	resp := editTasks("delete_tasks", testProject, 0, api.EditTasksRequest{
+		Filter: storage.TaskFilter{Status: storage.NEW},
+	}, testUserCtx)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestCancelTasks(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testcanceltasks",
+		GitRepo:  "testcanceltasks",
+		CloneUrl: "testcanceltasks",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	for i := 0; i < 3; i++ {
+		createTask(api.SubmitTaskRequest{
+			Project: pid,
+			Recipe:  fmt.Sprintf("cancel%d", i),
+		}, w)
+	}
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	resp := editTasks("cancel_task", pid, task.Id, api.EditTasksRequest{}, testAdminCtx)
+	if resp.Ok != true || resp.Content.AffectedTasks != 1 {
+		t.Error()
+	}
+	details := getTaskDetails(pid, task.Id, testAdminCtx).Content.Details.Task
+	if details.Status != storage.CANCELLED {
+		t.Error()
+	}
+	if details.Assignee != 0 {
+		t.Error()
+	}
+
+	resp = editTasks("cancel_tasks", pid, 0, api.EditTasksRequest{
+		Filter: storage.TaskFilter{Recipe: "cancel"},
+	}, testAdminCtx)
+	if resp.Content.AffectedTasks != 2 {
+		t.Error()
+	}
+
+	if getTaskFromProject(pid, w).Ok != false {
+		t.Error()
+	}
+}
+
+func TestCancelTasksUnauthorized(t *testing.T) {
+
+	resp := editTasks("cancel_tasks", testProject, 0, api.EditTasksRequest{
+		Filter: storage.TaskFilter{Status: storage.NEW},
+	}, testUserCtx)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestKeepCompletedTasks(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:               "testkeepcompletedtasks",
+		GitRepo:            "testkeepcompletedtasks",
+		CloneUrl:           "testkeepcompletedtasks",
+		KeepCompletedTasks: true,
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project:      pid,
+		Recipe:       "keep",
+		UniqueString: "keep",
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_OK,
+	}, w)
+
+	resp := getTaskDetails(pid, task.Id, testAdminCtx)
+	if resp.Ok != true {
+		t.Error()
+	}
+	if resp.Content.Details.Task.Status != storage.COMPLETED {
+		t.Error()
+	}
+	if getTaskFromProject(pid, w).Ok != false {
+		t.Error()
+	}
+
+	resp2 := editTasks("cancel_task", pid, task.Id, api.EditTasksRequest{}, testAdminCtx)
+	if resp2.Content.AffectedTasks != 0 {
+		t.Error()
+	}
+
+	resp3 := createTask(api.SubmitTaskRequest{
+		Project:      pid,
+		Recipe:       "keep",
+		UniqueString: "keep",
+	}, w)
+	if resp3.Ok != true {
+		t.Error()
+	}
+}
+
+func TestArchiveTasks(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:         "testarchivetasks",
+		GitRepo:      "testarchivetasks",
+		CloneUrl:     "testarchivetasks",
+		ArchiveTasks: true,
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project:  pid,
+		Recipe:   "archive1",
+		Priority: 2,
+	}, w)
+	createTask(api.SubmitTaskRequest{
+		Project:  pid,
+		Recipe:   "archive2",
+		Priority: 1,
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId:       task.Id,
+		Result:       storage.TR_OK,
+		Verification: 123,
+	}, w)
+
+	if getTaskDetails(pid, task.Id, testAdminCtx).Ok != false {
+		t.Error()
+	}
+
+	resp := getArchivedTasks(pid, 0, 10, testAdminCtx)
+	if resp.Ok != true || len(resp.Content.Tasks) != 1 {
+		t.Error()
+		return
+	}
+	archived := resp.Content.Tasks[0]
+	if archived.Id != task.Id || archived.Recipe != "archive1" {
+		t.Error()
+	}
+	if archived.Status != storage.COMPLETED {
+		t.Error()
+	}
+	if archived.Assignee != w.Id {
+		t.Error()
+	}
+	if archived.VerificationHash != 123 {
+		t.Error()
+	}
+	if archived.CompletionTime == 0 {
+		t.Error()
+	}
+
+	if editTasks("hard_reset", pid, 0, api.EditTasksRequest{}, testAdminCtx).Content.AffectedTasks != 1 {
+		t.Error()
+	}
+
+	resp = getArchivedTasks(pid, task.Id, 10, testAdminCtx)
+	if len(resp.Content.Tasks) != 1 {
+		t.Error()
+		return
+	}
+	if resp.Content.Tasks[0].Recipe != "archive2" || resp.Content.Tasks[0].Status != storage.NEW {
+		t.Error()
+	}
+}
+
+func TestArchiveTasksDisabled(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testarchivetasksdisabled",
+		GitRepo:  "testarchivetasksdisabled",
+		CloneUrl: "testarchivetasksdisabled",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  "noarchive",
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_OK,
+	}, w)
+
+	resp := getArchivedTasks(pid, 0, 10, testAdminCtx)
+	if resp.Ok != true || len(resp.Content.Tasks) != 0 {
+		t.Error()
+	}
+}
+
+func TestArchivedTasksUnauthorized(t *testing.T) {
+
+	resp := getArchivedTasks(testProject, 0, 10, testUserCtx)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestTaskDependencies(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskdependencies",
+		GitRepo:  "testtaskdependencies",
+		CloneUrl: "testtaskdependencies",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	parent := submitTask(api.SubmitTaskRequest{
+		Project:  pid,
+		Recipe:   "parent",
+		Priority: 1,
+	}, w).Content.Id
+
+	child := submitTask(api.SubmitTaskRequest{
+		Project:  pid,
+		Recipe:   "child",
+		Priority: 2,
+		Dependencies: []api.TaskDependencyRequest{
+			{TaskId: parent},
+		},
+	}, w)
+
+	if child.Ok != true {
+		t.Error()
+	}
+
+	task := getTaskFromProject(pid, w).Content.Task
+	if task.Id != parent {
+		t.Error()
+	}
+	if getTaskFromProject(pid, w).Ok != false {
+		t.Error()
+	}
+
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_OK,
+	}, w)
+
+	task = getTaskFromProject(pid, w).Content.Task
+	if task.Id != child.Content.Id {
+		t.Error()
+	}
+}
+
+func TestTaskDependencyCascadeFailure(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskdependencycascade",
+		GitRepo:  "testtaskdependencycascade",
+		CloneUrl: "testtaskdependencycascade",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	submitTask(api.SubmitTaskRequest{
+		Project:      pid,
+		Recipe:       "parent",
+		UniqueString: "parent",
+		MaxRetries:   1,
+	}, w)
+
+	child := submitTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  "child",
+		Dependencies: []api.TaskDependencyRequest{
+			{UniqueString: "parent", CascadeFailure: true},
+		},
+	}, w).Content.Id
+
+	if len(getTaskDetails(pid, child, testAdminCtx).Content.Details.Dependencies) != 1 {
+		t.Error()
+	}
+
+	task := getTaskFromProject(pid, w).Content.Task
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_FAIL,
+	}, w)
+
+	if getTaskDetails(pid, child, testAdminCtx).Content.Details.Task.Status != storage.FAILED {
+		t.Error()
+	}
+}
+
+func TestTaskDependencyFailureNoCascade(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskdependencynocascade",
+		GitRepo:  "testtaskdependencynocascade",
+		CloneUrl: "testtaskdependencynocascade",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	parent := submitTask(api.SubmitTaskRequest{
+		Project:    pid,
+		Recipe:     "parent",
+		Priority:   1,
+		MaxRetries: 1,
+	}, w).Content.Id
+
+	child := submitTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  "child",
+		Dependencies: []api.TaskDependencyRequest{
+			{TaskId: parent},
+		},
+	}, w).Content.Id
+
+	task := getTaskFromProject(pid, w).Content.Task
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_FAIL,
+	}, w)
+
+	// The parent is now FAILED, it can still be reset
+	if getTaskFromProject(pid, w).Ok != false {
+		t.Error()
+	}
+	if getTaskDetails(pid, child, testAdminCtx).Content.Details.Task.Status != storage.NEW {
+		t.Error()
+	}
+
+	editTasks("cancel_task", pid, parent, api.EditTasksRequest{}, testAdminCtx)
+
+	task = getTaskFromProject(pid, w).Content.Task
+	if task.Id != child {
+		t.Error()
+	}
+
+	// The parent is now CANCELLED
+	resp := submitTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  "child2",
+		Dependencies: []api.TaskDependencyRequest{
+			{TaskId: parent},
+		},
+	}, w)
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestTaskDependencyParentDeleted(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtaskdependencydeleted",
+		GitRepo:  "testtaskdependencydeleted",
+		CloneUrl: "testtaskdependencydeleted",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	parent := submitTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  "parent",
+	}, w).Content.Id
+
+	child := submitTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  "child",
+		Dependencies: []api.TaskDependencyRequest{
+			{TaskId: parent},
+		},
+	}, w).Content.Id
+
+	resp := editTasks("delete_task", pid, parent, api.EditTasksRequest{}, testAdminCtx)
+	if resp.Ok != true {
+		t.Error()
+	}
+
+	if getTaskFromProject(pid, w).Ok != false {
+		t.Error()
+	}
+	if getTaskDetails(pid, child, testAdminCtx).Content.Details.Task.Status != storage.CANCELLED {
+		t.Error()
+	}
+}
+
+func TestTaskDependencyNotFound(t *testing.T) {
+
+	resp := submitTask(api.SubmitTaskRequest{
+		Project: testProject,
+		Recipe:  "notfound",
+		Dependencies: []api.TaskDependencyRequest{
+			{UniqueString: "testtaskdependencynotfound"},
+		},
+	}, testWorker)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestTaskDependencyInvalid(t *testing.T) {
+
+	resp := submitTask(api.SubmitTaskRequest{
+		Project: testProject,
+		Recipe:  "invalid",
+		Dependencies: []api.TaskDependencyRequest{
+			{TaskId: 1, UniqueString: "both"},
+		},
+	}, testWorker)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestReleaseTaskWithChildren(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testreleasetaskwithchildren",
+		GitRepo:  "testreleasetaskwithchildren",
+		CloneUrl: "testreleasetaskwithchildren",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project:      pid,
+		Recipe:       "http://example.com/",
+		UniqueString: "http://example.com/",
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	resp := releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_OK,
+		Children: []api.SubmitTaskRequest{
+			{Project: pid, Recipe: "http://example.com/a", UniqueString: "http://example.com/a"},
+			{Project: pid, Recipe: "http://example.com/b", UniqueString: "http://example.com/b"},
+			{Project: pid, Recipe: "http://example.com/a", UniqueString: "http://example.com/a"},
+		},
+	}, w)
+
+	if resp.Ok != true || resp.Content.Updated != true {
+		t.Error()
+	}
+	if len(resp.Content.Children) != 3 {
+		t.Error()
+		return
+	}
+	if resp.Content.Children[0].Status != api.SUBMIT_INSERTED || resp.Content.Children[0].Id == 0 ||
+		resp.Content.Children[1].Status != api.SUBMIT_INSERTED ||
+		resp.Content.Children[2].Status != api.SUBMIT_DUPLICATE {
+		t.Error()
+	}
+
+	tasks := getTasks(api.GetTasksRequest{Count: 10}, pid, testAdminCtx).Content.Tasks
+	if len(tasks) != 2 {
+		t.Error()
+	}
+	if tasks[0].Recipe != "http://example.com/a" || tasks[1].Recipe != "http://example.com/b" {
+		t.Error()
+	}
+}
+
+func TestReleaseTaskChildFailure(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testreleasetaskchildfailure",
+		GitRepo:  "testreleasetaskchildfailure",
+		CloneUrl: "testreleasetaskchildfailure",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  "parent",
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	resp := releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_OK,
+		Children: []api.SubmitTaskRequest{
+			{Project: pid, Recipe: "ok"},
+			{Project: pid, Recipe: "unresolved", Dependencies: []api.TaskDependencyRequest{
+				{UniqueString: "testreleasetaskchildfailure"},
+			}},
+		},
+	}, w)
+
+	if resp.Ok != true || resp.Content.Updated != true {
+		t.Error()
+	}
+	if len(resp.Content.Children) != 2 {
+		t.Error()
+		return
+	}
+	if resp.Content.Children[0].Status != api.SUBMIT_INSERTED ||
+		resp.Content.Children[1].Status != api.SUBMIT_INVALID {
+		t.Error()
+	}
+
+	tasks := getTasks(api.GetTasksRequest{Count: 10}, pid, testAdminCtx).Content.Tasks
+	if len(tasks) != 1 || tasks[0].Recipe != "ok" {
+		t.Error()
+	}
+}
+
+func TestReleaseTaskChildrenUnauthorized(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testreleasetaskchildrenunauthorized",
+		GitRepo:  "testreleasetaskchildrenunauthorized",
+		CloneUrl: "testreleasetaskchildrenunauthorized",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  "parent",
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	resp := releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_OK,
+		Children: []api.SubmitTaskRequest{
+			{Project: testProject, Recipe: "child"},
+		},
+	}, w)
+
+	if resp.Ok != false {
+		t.Error()
+	}
+
+	details := getTaskDetails(pid, task.Id, testAdminCtx).Content.Details
+	if details == nil || details.Task.Assignee != w.Id {
+		t.Error()
+	}
+}
+
+func TestAssignStrategyFifoLifo(t *testing.T) {
+
+	fifo := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:           "testassignstrategyfifo",
+		GitRepo:        "testassignstrategyfifo",
+		CloneUrl:       "testassignstrategyfifo",
+		AssignStrategy: storage.ASSIGN_FIFO,
+	}).Content.Id
+	lifo := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:           "testassignstrategylifo",
+		GitRepo:        "testassignstrategylifo",
+		CloneUrl:       "testassignstrategylifo",
+		AssignStrategy: storage.ASSIGN_LIFO,
+	}).Content.Id
+
+	w := genWid()
+	for _, pid := range []int64{fifo, lifo} {
+		requestAccess(api.CreateWorkerAccessRequest{
+			Project: pid,
+			Submit:  true,
+			Assign:  true,
+		}, w)
+		acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+		for i := 0; i < 3; i++ {
+			createTask(api.SubmitTaskRequest{
+				Project: pid,
+				Recipe:  fmt.Sprintf("%d", i),
+			}, w)
+		}
+	}
+
+	if getTaskFromProject(fifo, w).Content.Task.Recipe != "0" {
+		t.Error()
+	}
+	if getTaskFromProject(lifo, w).Content.Task.Recipe != "2" {
+		t.Error()
+	}
+}
+
+func TestAssignStrategyFair(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:           "testassignstrategyfair",
+		GitRepo:        "testassignstrategyfair",
+		CloneUrl:       "testassignstrategyfair",
+		AssignStrategy: storage.ASSIGN_FAIR,
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	for _, group := range []string{"a.com", "a.com", "a.com", "b.com", "b.com"} {
+		createTask(api.SubmitTaskRequest{
+			Project: pid,
+			Recipe:  group,
+			Group:   group,
+		}, w)
+	}
+
+	t1 := getTaskFromProject(pid, w).Content.Task
+	t2 := getTaskFromProject(pid, w).Content.Task
+	t3 := getTaskFromProject(pid, w).Content.Task
+
+	if t1.Group != "a.com" || t2.Group != "b.com" || t3.Group != "a.com" {
+		t.Error()
+	}
+
+	tasks := getTasksFromProject(pid, 2, w).Content.Tasks
+	if len(tasks) != 2 || tasks[0].Group == tasks[1].Group {
+		t.Error()
+	}
+}
+
+func TestAssignStrategyInvalid(t *testing.T) {
+
+	resp := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:           "testassignstrategyinvalid",
+		GitRepo:        "testassignstrategyinvalid",
+		CloneUrl:       "testassignstrategyinvalid",
+		AssignStrategy: 42,
+	})
+
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestMaxInFlightPerGroup(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:                "testmaxinflightpergroup",
+		GitRepo:             "testmaxinflightpergroup",
+		CloneUrl:            "testmaxinflightpergroup",
+		AssignStrategy:      storage.ASSIGN_FIFO,
+		MaxInFlightPerGroup: 1,
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	for _, group := range []string{"a.com", "a.com", "b.com", "b.com", ""} {
+		createTask(api.SubmitTaskRequest{
+			Project: pid,
+			Recipe:  group,
+			Group:   group,
+		}, w)
+	}
+
+	t1 := getTaskFromProject(pid, w).Content.Task
+	if t1.Group != "a.com" {
+		t.Error()
+	}
+
+	tasks := getTasksFromProject(pid, 10, w).Content.Tasks
+	if len(tasks) != 2 || tasks[0].Group != "b.com" || tasks[1].Group != "" {
+		t.Error()
+	}
+
+	resp := getTaskFromProject(pid, w)
+	if resp.Ok != false {
+		t.Error()
+	}
+
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId: t1.Id,
+		Result: storage.TR_OK,
+	}, w)
+
+	t2 := getTaskFromProject(pid, w).Content.Task
+	if t2.Group != "a.com" {
+		t.Error()
+	}
+}
+
+func TestMaxInFlightPerGroupInvalid(t *testing.T) {
+
+	resp := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:                "testmaxinflightpergroupinvalid",
+		GitRepo:             "testmaxinflightpergroupinvalid",
+		CloneUrl:            "testmaxinflightpergroupinvalid",
+		MaxInFlightPerGroup: -1,
+	})
+
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestDedupCompletedTask(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:      "testdedupcompletedtask",
+		GitRepo:   "testdedupcompletedtask",
+		CloneUrl:  "testdedupcompletedtask",
+		DedupMode: storage.DEDUP_FOREVER,
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project:      pid,
+		Recipe:       "a",
+		UniqueString: "a",
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_OK,
+	}, w)
+
+	resp := createTask(api.SubmitTaskRequest{
+		Project:      pid,
+		Recipe:       "a",
+		UniqueString: "a",
+	}, w)
+	if resp.Ok != false || !strings.Contains(resp.Message, "recently completed") {
+		t.Error()
+	}
+
+	var bulkResp BulkSubmitTaskAR
+	r := Post("/task/bulk_submit", api.BulkSubmitTaskRequest{
+		Requests: []api.SubmitTaskRequest{
+			{Project: pid, Recipe: "b", UniqueString: "b"},
+			{Project: pid, Recipe: "a", UniqueString: "a"},
+		},
+	}, w, nil)
+	UnmarshalResponse(r, &bulkResp)
+
+	if bulkResp.Ok != true || len(bulkResp.Content.Results) != 2 ||
+		bulkResp.Content.Results[0].Status != api.SUBMIT_INSERTED ||
+		bulkResp.Content.Results[1].Status != api.SUBMIT_RECENTLY_COMPLETED {
+		t.Error()
+	}
+
+	task = getTaskFromProject(pid, w).Content.Task
+	if task.Id == 0 || task.Recipe != "b" {
+		t.Error()
+	}
+}
+
+func TestRecipeSchema(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:         "testrecipeschema",
+		GitRepo:      "testrecipeschema",
+		CloneUrl:     "testrecipeschema",
+		RecipeSchema: `{"type":"object","required":["url"],"properties":{"url":{"type":"string","pattern":"^https?://"}}}`,
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	resp := createTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  `{"url":"https://example.com"}`,
+	}, w)
+	if resp.Ok != true {
+		t.Error()
+	}
+
+	resp = createTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  `{"url":"ftp://example.com"}`,
+	}, w)
+	if resp.Ok != false || !strings.Contains(resp.Message, "pattern") {
+		t.Error()
+	}
+
+	resp = createTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  `{}`,
+	}, w)
+	if resp.Ok != false || !strings.Contains(resp.Message, "url") {
+		t.Error()
+	}
+
+	resp = createTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  "not json",
+	}, w)
+	if resp.Ok != false {
+		t.Error()
+	}
+
+	var bulkResp BulkSubmitTaskAR
+	r := Post("/task/bulk_submit", api.BulkSubmitTaskRequest{
+		Requests: []api.SubmitTaskRequest{
+			{Project: pid, Recipe: `{"url":1}`},
+			{Project: pid, Recipe: `{"url":"http://a.com"}`},
+			{Project: pid, Recipe: `[]`},
+			{Project: pid, Recipe: `{"url":"http://b.com"}`},
+		},
+	}, w, nil)
+	UnmarshalResponse(r, &bulkResp)
+
+	if bulkResp.Ok != true || len(bulkResp.Content.Results) != 4 {
+		t.Error()
+		return
+	}
+	for i, status := range []api.SubmitStatus{api.SUBMIT_INVALID, api.SUBMIT_INSERTED,
+		api.SUBMIT_INVALID, api.SUBMIT_INSERTED} {
+		if bulkResp.Content.Results[i].Status != status {
+			t.Error()
+		}
+	}
+
+	if len(getTasks(api.GetTasksRequest{Count: 10}, pid, testAdminCtx).Content.Tasks) != 3 {
+		t.Error()
+	}
+
+	resp = createTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  `{}`,
+	}, genWid())
+	if resp.Ok != false || strings.Contains(resp.Message, "recipe") {
+		t.Error()
+	}
+}
+
+func TestRecipeSchemaUpdate(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testrecipeschemaupdate",
+		GitRepo:  "testrecipeschemaupdate",
+		CloneUrl: "testrecipeschemaupdate",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	if createTask(api.SubmitTaskRequest{Project: pid, Recipe: "plain"}, w).Ok != true {
+		t.Error()
+	}
+
+	schema := `{"type":"integer","minimum":0}`
+	updateResp := updateProject(api.UpdateProjectRequest{
+		Name:         "testrecipeschemaupdate",
+		GitRepo:      "testrecipeschemaupdate",
+		CloneUrl:     "testrecipeschemaupdate",
+		RecipeSchema: &schema,
+	}, pid, testAdminCtx)
+	if updateResp.Ok != true {
+		t.Error()
+	}
+
+	// The schema is left unchanged if omitted
+	updateResp = updateProject(api.UpdateProjectRequest{
+		Name:     "testrecipeschemaupdate",
+		GitRepo:  "testrecipeschemaupdate",
+		CloneUrl: "testrecipeschemaupdate",
+	}, pid, testAdminCtx)
+	if updateResp.Ok != true {
+		t.Error()
+	}
+
+	if createTask(api.SubmitTaskRequest{Project: pid, Recipe: "plain2"}, w).Ok != false {
+		t.Error()
+	}
+	if createTask(api.SubmitTaskRequest{Project: pid, Recipe: "-1"}, w).Ok != false {
+		t.Error()
+	}
+	if createTask(api.SubmitTaskRequest{Project: pid, Recipe: "12"}, w).Ok != true {
+		t.Error()
+	}
+
+	schema = `{"type":"integer"}`
+	updateResp = updateProject(api.UpdateProjectRequest{
+		Name:         "testrecipeschemaupdate",
+		GitRepo:      "testrecipeschemaupdate",
+		CloneUrl:     "testrecipeschemaupdate",
+		RecipeSchema: &schema,
+	}, pid, testUserCtx)
+	if updateResp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestRecipeSchemaReleaseChildren(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:         "testrecipeschemachildren",
+		GitRepo:      "testrecipeschemachildren",
+		CloneUrl:     "testrecipeschemachildren",
+		RecipeSchema: `{"type":"object","required":["url"]}`,
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{Project: pid, Recipe: `{"url":"a"}`}, w)
+	createTask(api.SubmitTaskRequest{Project: pid, Recipe: `{"url":"b"}`}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+
+	resp := releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_OK,
+		Children: []api.SubmitTaskRequest{
+			{Project: pid, Recipe: `{"title":"a"}`},
+			{Project: pid, Recipe: `{"url":"a/1"}`},
+		},
+	}, w)
+
+	if resp.Ok != true || resp.Content.Updated != true || len(resp.Content.Children) != 2 {
+		t.Error()
+		return
+	}
+	if resp.Content.Children[0].Status != api.SUBMIT_INVALID ||
+		resp.Content.Children[1].Status != api.SUBMIT_INSERTED {
+		t.Error()
+	}
+
+	task = getTaskFromProject(pid, w).Content.Task
+
+	bulkResp := bulkReleaseTask(api.BulkReleaseTaskRequest{
+		Requests: []api.ReleaseTaskRequest{{
+			TaskId: task.Id,
+			Result: storage.TR_OK,
+			Children: []api.SubmitTaskRequest{
+				{Project: pid, Recipe: `{"url":"b/1"}`},
+				{Project: pid, Recipe: `[]`},
+			},
+		}},
+	}, w)
+
+	if bulkResp.Ok != true || len(bulkResp.Content.Results) != 1 {
+		t.Error()
+		return
+	}
+	children := bulkResp.Content.Results[0].Children
+	if len(children) != 2 || children[0].Status != api.SUBMIT_INSERTED ||
+		children[1].Status != api.SUBMIT_INVALID {
+		t.Error()
+	}
+
+	tasks := getTasks(api.GetTasksRequest{Count: 10}, pid, testAdminCtx).Content.Tasks
+	if len(tasks) != 2 {
+		t.Error()
+	}
+}
+
+func TestRecipeSchemaInvalid(t *testing.T) {
+
+	resp := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:         "testrecipeschemainvalid",
+		GitRepo:      "testrecipeschemainvalid",
+		CloneUrl:     "testrecipeschemainvalid",
+		RecipeSchema: `{"type":"url"}`,
+	})
+	if resp.Ok != false {
+		t.Error()
+	}
+
+	resp = createProjectAsAdmin(api.CreateProjectRequest{
+		Name:         "testrecipeschemainvalid2",
+		GitRepo:      "testrecipeschemainvalid2",
+		CloneUrl:     "testrecipeschemainvalid2",
+		RecipeSchema: `{"type":"string","pattern":"("}`,
+	})
+	if resp.Ok != false {
+		t.Error()
+	}
+
+	resp = createProjectAsAdmin(api.CreateProjectRequest{
+		Name:         "testrecipeschemainvalid3",
+		GitRepo:      "testrecipeschemainvalid3",
+		CloneUrl:     "testrecipeschemainvalid3",
+		RecipeSchema: `not json`,
+	})
+	if resp.Ok != false {
+		t.Error()
+	}
+
+	resp = createProjectAsAdmin(api.CreateProjectRequest{
+		Name:         "testrecipeschemainvalid4",
+		GitRepo:      "testrecipeschemainvalid4",
+		CloneUrl:     "testrecipeschemainvalid4",
+		RecipeSchema: `{"type":"object","properties":{"url":{"anyOf":[{"type":"string"}]}}}`,
+	})
+	if resp.Ok != false {
+		t.Error()
+	}
+
+	resp = createProjectAsAdmin(api.CreateProjectRequest{
+		Name:         "testrecipeschemainvalid5",
+		GitRepo:      "testrecipeschemainvalid5",
+		CloneUrl:     "testrecipeschemainvalid5",
+		RecipeSchema: `{"title":"Recipe","type":"string","format":"uri"}`,
+	})
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestDedupNone(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testdedupnone",
+		GitRepo:  "testdedupnone",
+		CloneUrl: "testdedupnone",
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project:      pid,
+		Recipe:       "a",
+		UniqueString: "a",
+	}, w)
+
+	task := getTaskFromProject(pid, w).Content.Task
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId: task.Id,
+		Result: storage.TR_OK,
+	}, w)
+
+	resp := createTask(api.SubmitTaskRequest{
+		Project:      pid,
+		Recipe:       "a",
+		UniqueString: "a",
+	}, w)
+	if resp.Ok != true {
+		t.Error()
+	}
+}
+
+func TestDedupInvalid(t *testing.T) {
+
+	resp := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:      "testdedupinvalid",
+		GitRepo:   "testdedupinvalid",
+		CloneUrl:  "testdedupinvalid",
+		DedupMode: storage.DEDUP_TTL,
+	})
+
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
+func TestVerificationDisputed(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:                    "testverificationdisputed",
+		GitRepo:                 "testverificationdisputed",
+		CloneUrl:                "testverificationdisputed",
+		MaxVerificationAttempts: 2,
+	}).Content.Id
+
+	workers := []*storage.Worker{genWid(), genWid(), genWid()}
+	for _, w := range workers {
+		requestAccess(api.CreateWorkerAccessRequest{
+			Project: pid,
+			Submit:  true,
+			Assign:  true,
+		}, w)
+		acceptAccessRequest(pid, w.Id, testAdminCtx)
+	}
+
+	createTask(api.SubmitTaskRequest{
+		Project:           pid,
+		Recipe:            "disputed",
+		VerificationCount: 2,
+	}, workers[0])
+
+	var tid int64
+	for i, w := range workers[:2] {
+		task := getTaskFromProject(pid, w).Content.Task
+		tid = task.Id
+		releaseTask(api.ReleaseTaskRequest{
+			TaskId:       task.Id,
+			Result:       storage.TR_OK,
+			Verification: int64(i),
+		}, w)
+	}
+
+	if getTaskFromProject(pid, workers[2]).Ok != false {
+		t.Error()
+	}
+
+	details := getTaskDetails(pid, tid, testAdminCtx).Content.Details
+	if details.Task.Status != storage.DISPUTED || len(details.Verifications) != 2 {
+		t.Error()
+	}
+
+	resp := editTasks("requeue_task", pid, tid, api.EditTasksRequest{}, testAdminCtx)
+	if resp.Content.AffectedTasks != 1 {
+		t.Error()
+	}
+
+	details = getTaskDetails(pid, tid, testAdminCtx).Content.Details
+	if details.Task.Status != storage.NEW || len(details.Verifications) != 0 {
+		t.Error()
+	}
+	if getTaskFromProject(pid, workers[2]).Ok != true {
+		t.Error()
+	}
+}
+
+func bulkSubmitTask(request api.BulkSubmitTaskRequest, worker *storage.Worker) (ar api.JsonResponse) {
+	r := Post("/task/bulk_submit", request, worker, nil)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func createTask(request api.SubmitTaskRequest, worker *storage.Worker) (ar api.JsonResponse) {
+	r := Post("/task/submit", request, worker, nil)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func getTask(worker *storage.Worker) (ar client.AssignTaskResponse) {
+	r := Get("/task/get", worker, nil)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func getTaskFromProject(project int64, worker *storage.Worker) (ar client.AssignTaskResponse) {
+	r := Get(fmt.Sprintf("/task/get/%d", project), worker, nil)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func bulkReleaseTask(request api.BulkReleaseTaskRequest, worker *storage.Worker) (ar client.BulkReleaseTaskResponse) {
+	r := Post("/task/bulk_release", request, worker, nil)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func getTaskFromProjectWait(project int64, wait int, worker *storage.Worker) (ar client.AssignTaskResponse) {
+	r := Get(fmt.Sprintf("/task/get/%d?wait=%d", project, wait), worker, nil)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func taskHeartbeat(request api.TaskHeartbeatRequest, worker *storage.Worker) (ar client.TaskHeartbeatResponse) {
+	r := Post("/task/heartbeat", request, worker, nil)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func taskProgress(request api.TaskProgressRequest, worker *storage.Worker) (ar api.JsonResponse) {
+	r := Post("/task/progress", request, worker, nil)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func getTasksFromProject(project int64, count int, worker *storage.Worker) (ar client.AssignTasksResponse) {
+	r := Get(fmt.Sprintf("/task/bulk_get/%d?count=%d", project, count), worker, nil)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func releaseTask(request api.ReleaseTaskRequest, worker *storage.Worker) (ar client.ReleaseTaskResponse) {
+	r := Post("/task/release", request, worker, nil)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func getFailedTasks(pid int64, after int64, count int, s *http.Client) (ar FailedTasksAR) {
+	r := Get(fmt.Sprintf("/project/failed_tasks/%d?after=%d&count=%d", pid, after, count), nil, s)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func getArchivedTasks(pid int64, after int64, count int, s *http.Client) (ar ArchivedTasksAR) {
+	r := Get(fmt.Sprintf("/project/archived_tasks/%d?after=%d&count=%d", pid, after, count), nil, s)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func getResults(pid int64, after int64, count int, s *http.Client) (ar ResultsAR) {
+	r := Get(fmt.Sprintf("/project/results/%d?after=%d&count=%d", pid, after, count), nil, s)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func getTasks(request api.GetTasksRequest, pid int64, s *http.Client) (ar TasksAR) {
+	r := Post(fmt.Sprintf("/project/tasks/%d", pid), request, nil, s)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func getTaskDetails(pid int64, tid int64, s *http.Client) (ar TaskDetailsAR) {
+	r := Get(fmt.Sprintf("/project/task/%d/%d", pid, tid), nil, s)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func editTasks(action string, pid int64, tid int64, request api.EditTasksRequest, s *http.Client) (ar EditTasksAR) {
+	path := fmt.Sprintf("/project/%s/%d", action, pid)
+	if tid != 0 {
+		path = fmt.Sprintf("/project/%s/%d/%d", action, pid, tid)
+	}
+	r := Post(path, request, nil, s)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func submitTask(request api.SubmitTaskRequest, worker *storage.Worker) (ar SubmitTaskAR) {
+	r := Post("/task/submit", request, worker, nil)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+func TestAssignStrategyFairPurgedGroup(t *testing.T) {
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:           "testassignstrategyfairpurgedgroup",
+		GitRepo:        "testassignstrategyfairpurgedgroup",
+		CloneUrl:       "testassignstrategyfairpurgedgroup",
+		AssignStrategy: storage.ASSIGN_FAIR,
+	}).Content.Id
+
+	w := genWid()
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: pid,
+		Submit:  true,
+		Assign:  true,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  "1",
+		Group:   "a.com",
+	}, w)
+	t1 := getTaskFromProject(pid, w).Content.Task
+	releaseTask(api.ReleaseTaskRequest{
+		TaskId: t1.Id,
+		Result: storage.TR_OK,
+	}, w)
+
+	testApi.Database.PurgeTaskGroups()
+
+	createTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  "2",
+		Group:   "a.com",
+	}, w)
+	t2 := getTaskFromProject(pid, w).Content.Task
+	if t2.Id == 0 || t2.Recipe != "2" {
+		t.Error()
+	}
 }
@@ -186,6 +186,363 @@ func TestPauseUnauthorized(t *testing.T) {
 	}
 }
 
+func TestWorkerTags(t *testing.T) {
+
+	resp := createWorker(api.CreateWorkerRequest{
+		Tags: []string{"gpu", "eu"},
+	})
+	w := resp.Content.Worker
+
+	if resp.Ok != true || len(w.Tags) != 2 {
+		t.Error()
+	}
+
+	updateWorker(api.UpdateWorkerRequest{
+		Alias: "tagged",
+	}, w)
+	if len(getWorker(w.Id).Content.Worker.Tags) != 2 {
+		t.Error()
+	}
+
+	updateWorker(api.UpdateWorkerRequest{
+		Alias: "tagged",
+		Tags:  []string{"us"},
+	}, w)
+	tags := getWorker(w.Id).Content.Worker.Tags
+	if len(tags) != 1 || tags[0] != "us" {
+		t.Error()
+	}
+}
+
+func TestWorkerTagsInvalid(t *testing.T) {
+
+	resp := createWorker(api.CreateWorkerRequest{
+		Tags: []string{""},
+	})
+	if resp.Ok != false {
+		t.Error()
+	}
+
+	r := updateWorker(api.UpdateWorkerRequest{
+		Tags: []string{strings.Repeat("a", api.MaxTagLength+1)},
+	}, genWid())
+	if r.Ok != false {
+		t.Error()
+	}
+}
+
+func TestAssignRequiredTags(t *testing.T) {
+
+	gpu := createWorker(api.CreateWorkerRequest{
+		Tags: []string{"gpu", "eu"},
+	}).Content.Worker
+	cpu := createWorker(api.CreateWorkerRequest{
+		Tags: []string{"eu"},
+	}).Content.Worker
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testassignrequiredtags",
+		CloneUrl: "testassignrequiredtags",
+		GitRepo:  "testassignrequiredtags",
+	}).Content.Id
+
+	for _, w := range []*storage.Worker{gpu, cpu} {
+		requestAccess(api.CreateWorkerAccessRequest{
+			Submit:  true,
+			Assign:  true,
+			Project: pid,
+		}, w)
+		acceptAccessRequest(pid, w.Id, testAdminCtx)
+	}
+
+	createTask(api.SubmitTaskRequest{
+		Project:      pid,
+		Recipe:       "gpu",
+		RequiredTags: []string{"gpu"},
+	}, gpu)
+
+	resp := getTaskFromProject(pid, cpu)
+	if resp.Ok != false {
+		t.Error()
+	}
+
+	task := getTaskFromProject(pid, gpu).Content.Task
+	if task.Id == 0 || task.Recipe != "gpu" || len(task.RequiredTags) != 1 {
+		t.Error()
+	}
+
+	createTask(api.SubmitTaskRequest{
+		Project:      pid,
+		Recipe:       "eu",
+		RequiredTags: []string{"eu"},
+	}, gpu)
+
+	task = getTaskFromProject(pid, cpu).Content.Task
+	if task.Id == 0 || task.Recipe != "eu" {
+		t.Error()
+	}
+}
+
+func TestMaxConcurrentTasks(t *testing.T) {
+
+	w := genWid()
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:                      "testmaxconcurrenttasks",
+		CloneUrl:                  "testmaxconcurrenttasks",
+		GitRepo:                   "testmaxconcurrenttasks",
+		DefaultMaxConcurrentTasks: 1,
+	}).Content.Id
+
+	requestAccess(api.CreateWorkerAccessRequest{
+		Submit:  true,
+		Assign:  true,
+		Project: pid,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	for _, recipe := range []string{"a", "b", "c", "d"} {
+		createTask(api.SubmitTaskRequest{
+			Project: pid,
+			Recipe:  recipe,
+		}, w)
+	}
+
+	if getTaskFromProject(pid, w).Ok != true {
+		t.Error()
+	}
+
+	resp := getTaskFromProject(pid, w)
+	if resp.Ok != false || !strings.Contains(resp.Message, "Too many assigned tasks") {
+		t.Error()
+	}
+
+	r := setMaxConcurrentTasks(&api.WorkerSetMaxConcurrentTasksRequest{
+		Worker:             w.Id,
+		MaxConcurrentTasks: 3,
+	}, testAdminCtx)
+	if r.Ok != true {
+		t.Error()
+	}
+
+	tasks := getTasksFromProject(pid, 10, w).Content.Tasks
+	if len(tasks) != 2 {
+		t.Error()
+	}
+
+	if getTaskFromProject(pid, w).Ok != false {
+		t.Error()
+	}
+}
+
+func TestMaxConcurrentTasksKeepsPaused(t *testing.T) {
+
+	w := genWid()
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testmaxconcurrenttaskskeepspaused",
+		CloneUrl: "testmaxconcurrenttaskskeepspaused",
+		GitRepo:  "testmaxconcurrenttaskskeepspaused",
+	}).Content.Id
+
+	requestAccess(api.CreateWorkerAccessRequest{
+		Submit:  true,
+		Assign:  true,
+		Project: pid,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	createTask(api.SubmitTaskRequest{
+		Project: pid,
+		Recipe:  "a",
+	}, w)
+
+	pauseWorker(&api.WorkerSetPausedRequest{
+		Paused: true,
+		Worker: w.Id,
+	}, testAdminCtx)
+	setMaxConcurrentTasks(&api.WorkerSetMaxConcurrentTasksRequest{
+		Worker:             w.Id,
+		MaxConcurrentTasks: 3,
+	}, testAdminCtx)
+
+	resp := getTaskFromProject(pid, w)
+	if resp.Ok != false || !strings.Contains(resp.Message, "paused") {
+		t.Error()
+	}
+}
+
+func TestMaxConcurrentTasksUnauthorized(t *testing.T) {
+
+	w := genWid()
+
+	r := setMaxConcurrentTasks(&api.WorkerSetMaxConcurrentTasksRequest{
+		Worker:             w.Id,
+		MaxConcurrentTasks: 1,
+	}, testUserCtx)
+
+	if r.Ok != false {
+		t.Error()
+	}
+}
+
+func TestMaxConcurrentTasksInvalid(t *testing.T) {
+
+	r := setMaxConcurrentTasks(&api.WorkerSetMaxConcurrentTasksRequest{
+		Worker:             genWid().Id,
+		MaxConcurrentTasks: -1,
+	}, testAdminCtx)
+
+	if r.Ok != false {
+		t.Error()
+	}
+}
+
+func TestWorkerReputation(t *testing.T) {
+
+	w := genWid()
+
+	if getWorker(w.Id).Content.Worker.Reputation != 0.5 {
+		t.Error()
+	}
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testworkerreputation",
+		CloneUrl: "testworkerreputation",
+		GitRepo:  "testworkerreputation",
+	}).Content.Id
+	releaseTasks(pid, w, storage.TR_FAIL, 1)
+
+	reputation := getWorker(w.Id).Content.Worker.Reputation
+	if reputation >= 0.5 {
+		t.Error()
+	}
+
+	var statsResp WorkerStatsAR
+	r := Get("/worker/stats", nil, nil)
+	UnmarshalResponse(r, &statsResp)
+
+	for _, stats := range statsResp.Content.Stats {
+		if stats.Id == w.Id && (stats.ReleasedFailCount != 1 || stats.Reputation != reputation) {
+			t.Error()
+		}
+	}
+}
+
+func TestMinReputation(t *testing.T) {
+
+	w := genWid()
+	w2 := genWid()
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testminreputation1",
+		CloneUrl: "testminreputation1",
+		GitRepo:  "testminreputation1",
+	}).Content.Id
+	releaseTasks(pid, w, storage.TR_FAIL, 1)
+
+	pid2 := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:          "testminreputation2",
+		CloneUrl:      "testminreputation2",
+		GitRepo:       "testminreputation2",
+		MinReputation: 0.45,
+	}).Content.Id
+
+	for _, worker := range []*storage.Worker{w, w2} {
+		requestAccess(api.CreateWorkerAccessRequest{
+			Submit:  true,
+			Assign:  true,
+			Project: pid2,
+		}, worker)
+		acceptAccessRequest(pid2, worker.Id, testAdminCtx)
+	}
+
+	createTask(api.SubmitTaskRequest{
+		Project: pid2,
+		Recipe:  "a",
+	}, w2)
+
+	if getTaskFromProject(pid2, w).Ok != false {
+		t.Error()
+	}
+	if getTaskFromProject(pid2, w2).Ok != true {
+		t.Error()
+	}
+}
+
+func TestTrustedVerificationCount(t *testing.T) {
+
+	trusted := genWid()
+	w := genWid()
+
+	pid := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:     "testtrustedverification1",
+		CloneUrl: "testtrustedverification1",
+		GitRepo:  "testtrustedverification1",
+	}).Content.Id
+	verifyTasks(pid, []*storage.Worker{trusted, genWid()}, 10)
+
+	// TR_OK releases alone don't make a worker trusted
+	releaseTasks(pid, w, storage.TR_OK, 10)
+
+	pid2 := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:                     "testtrustedverification2",
+		CloneUrl:                 "testtrustedverification2",
+		GitRepo:                  "testtrustedverification2",
+		TrustedReputation:        0.6,
+		TrustedVerificationCount: 1,
+	}).Content.Id
+
+	for _, worker := range []*storage.Worker{trusted, w} {
+		requestAccess(api.CreateWorkerAccessRequest{
+			Submit:  true,
+			Assign:  true,
+			Project: pid2,
+		}, worker)
+		acceptAccessRequest(pid2, worker.Id, testAdminCtx)
+	}
+
+	createTask(api.SubmitTaskRequest{
+		Project:           pid2,
+		Recipe:            "a",
+		VerificationCount: 2,
+	}, w)
+
+	task := getTaskFromProject(pid2, w).Content.Task
+	resp := releaseTask(api.ReleaseTaskRequest{
+		TaskId:       task.Id,
+		Result:       storage.TR_OK,
+		Verification: 1,
+	}, w)
+	if resp.Content.Updated != false {
+		t.Error()
+	}
+
+	task = getTaskFromProject(pid2, trusted).Content.Task
+	resp = releaseTask(api.ReleaseTaskRequest{
+		TaskId:       task.Id,
+		Result:       storage.TR_OK,
+		Verification: 2,
+	}, trusted)
+	if resp.Content.Updated != true {
+		t.Error()
+	}
+}
+
+func TestReputationPolicyInvalid(t *testing.T) {
+
+	resp := createProjectAsAdmin(api.CreateProjectRequest{
+		Name:          "testreputationpolicyinvalid",
+		CloneUrl:      "testreputationpolicyinvalid",
+		GitRepo:       "testreputationpolicyinvalid",
+		MinReputation: 2,
+	})
+
+	if resp.Ok != false {
+		t.Error()
+	}
+}
+
 func createWorker(req api.CreateWorkerRequest) (ar client.CreateWorkerResponse) {
 	r := Post("/worker/create", req, nil, nil)
 	UnmarshalResponse(r, &ar)
@@ -234,3 +591,61 @@ func pauseWorker(request *api.WorkerSetPausedRequest, s *http.Client) (ar api.Js
 	UnmarshalResponse(r, &ar)
 	return
 }
+
+func setMaxConcurrentTasks(request *api.WorkerSetMaxConcurrentTasksRequest, s *http.Client) (ar api.JsonResponse) {
+	r := Post("/worker/set_max_concurrent_tasks", request, nil, s)
+	UnmarshalResponse(r, &ar)
+	return
+}
+
+// Submits, gets and releases count tasks in the project
+// Each worker releases each task with the same verification hash
+func verifyTasks(pid int64, workers []*storage.Worker, count int) {
+
+	for _, w := range workers {
+		requestAccess(api.CreateWorkerAccessRequest{
+			Submit:  true,
+			Assign:  true,
+			Project: pid,
+		}, w)
+		acceptAccessRequest(pid, w.Id, testAdminCtx)
+	}
+
+	for i := 0; i < count; i++ {
+		createTask(api.SubmitTaskRequest{
+			Project:           pid,
+			Recipe:            fmt.Sprintf("verify%d", i),
+			VerificationCount: int16(len(workers)),
+		}, workers[0])
+		for _, w := range workers {
+			task := getTaskFromProject(pid, w).Content.Task
+			releaseTask(api.ReleaseTaskRequest{
+				TaskId:       task.Id,
+				Result:       storage.TR_OK,
+				Verification: 1,
+			}, w)
+		}
+	}
+}
+
+func releaseTasks(pid int64, w *storage.Worker, result storage.TaskResult, count int) {
+
+	requestAccess(api.CreateWorkerAccessRequest{
+		Submit:  true,
+		Assign:  true,
+		Project: pid,
+	}, w)
+	acceptAccessRequest(pid, w.Id, testAdminCtx)
+
+	for i := 0; i < count; i++ {
+		createTask(api.SubmitTaskRequest{
+			Project: pid,
+			Recipe:  fmt.Sprintf("%d", i),
+		}, w)
+		task := getTaskFromProject(pid, w).Content.Task
+		releaseTask(api.ReleaseTaskRequest{
+			TaskId: task.Id,
+			Result: result,
+		}, w)
+	}
+}
@@ -62,7 +62,7 @@ func TestClientFetchTask(t *testing.T) {
 		t.Error()
 	}
 
-	if resp.Content.Task == nil {
+	if resp.Content.Task.Id == 0 {
 		t.Error()
 	}
 }
@@ -103,3 +103,78 @@ func TestClientReleaseTask(t *testing.T) {
 		t.Error()
 	}
 }
+
+func TestClientFetchTasks(t *testing.T) {
+
+	c := client.New(config.Cfg.ServerAddr)
+	w, _ := c.MakeWorker("test")
+	c.SetWorker(w)
+
+	createTask(api.SubmitTaskRequest{
+		Project: testProject,
+		Recipe:  "   ",
+	}, testWorker)
+	createTask(api.SubmitTaskRequest{
+		Project: testProject,
+		Recipe:  "   ",
+	}, testWorker)
+
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: testProject,
+		Submit:  false,
+		Assign:  true,
+	}, &storage.Worker{
+		Secret: w.Secret,
+		Id:     w.Id,
+	})
+	acceptAccessRequest(testProject, w.Id, testAdminCtx)
+
+	resp, err := c.FetchTasks(int(testProject), 2)
+
+	if err != nil {
+		t.Error()
+	}
+
+	if len(resp.Content.Tasks) != 2 {
+		t.Error()
+	}
+}
+
+func TestClientBulkSubmitTasks(t *testing.T) {
+
+	c := client.New(config.Cfg.ServerAddr)
+	w, _ := c.MakeWorker("test")
+	c.SetWorker(w)
+
+	requestAccess(api.CreateWorkerAccessRequest{
+		Project: testProject,
+		Submit:  true,
+		Assign:  false,
+	}, &storage.Worker{
+		Secret: w.Secret,
+		Id:     w.Id,
+	})
+	acceptAccessRequest(testProject, w.Id, testAdminCtx)
+
+	resp, err := c.BulkSubmitTasks(api.BulkSubmitTaskRequest{
+		Requests: []api.SubmitTaskRequest{
+			{Project: testProject, Recipe: "client bulk", UniqueString: "clientbulksubmit"},
+			{Project: testProject, Recipe: "client bulk", UniqueString: "clientbulksubmit"},
+		},
+	})
+
+	if err != nil || resp.Ok != true {
+		t.Error()
+		return
+	}
+	if len(resp.Content.Results) != 2 {
+		t.Error()
+		return
+	}
+	if resp.Content.Results[0].Status != api.SUBMIT_INSERTED || resp.Content.Results[0].Id == 0 {
+		t.Error()
+	}
+	if resp.Content.Results[1].Status != api.SUBMIT_DUPLICATE {
+		t.Error()
+	}
+}
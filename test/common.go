@@ -155,3 +155,83 @@ type AccountAR struct {
 		*storage.Manager `json:"manager"`
 	} `json:"content"`
 }
+
+type BulkTaskHeartbeatAR struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+	Content struct {
+		Leases []storage.TaskLease `json:"leases"`
+	} `json:"content"`
+}
+
+type FailedTasksAR struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+	Content struct {
+		Tasks []storage.FailedTask `json:"tasks"`
+	} `json:"content"`
+}
+
+type ResultsAR struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+	Content struct {
+		Results []storage.TaskResultRecord `json:"results"`
+	} `json:"content"`
+}
+
+type TasksAR struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+	Content struct {
+		Tasks []storage.Task `json:"tasks"`
+	} `json:"content"`
+}
+
+type TaskDetailsAR struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+	Content struct {
+		Details *storage.TaskDetails `json:"details"`
+	} `json:"content"`
+}
+
+type EditTasksAR struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+	Content struct {
+		AffectedTasks int64 `json:"affected_tasks"`
+	} `json:"content"`
+}
+
+type ArchivedTasksAR struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+	Content struct {
+		Tasks []storage.ArchivedTask `json:"tasks"`
+	} `json:"content"`
+}
+
+type BulkSubmitTaskAR struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+	Content struct {
+		Results []api.BulkSubmitTaskResult `json:"results"`
+	} `json:"content"`
+}
+
+type WorkerStatsAR struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+	Content struct {
+		Stats []storage.WorkerStats `json:"stats"`
+	} `json:"content"`
+}
+
+type SubmitTaskAR struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+	Content struct {
+		Id int64 `json:"id"`
+	} `json:"content"`
+}
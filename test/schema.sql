@@ -1,6 +1,8 @@
 DROP TABLE IF EXISTS worker, project, task, log_entry,
     worker_access, manager, manager_has_role_on_project, project_monitoring_snapshot,
-    worker_verifies_task;
+    worker_verifies_task, task_attempt, task_result, task_dependency, project_chain, task_group,
+    completed_hash, task_status_transition, task_archive;
+DROP SEQUENCE IF EXISTS task_group_assign_seq;
 
 CREATE TABLE worker
 (
@@ -9,7 +11,13 @@ CREATE TABLE worker
     created           INTEGER            NOT NULL,
     secret            BYTEA              NOT NULL,
     closed_task_count INTEGER                     DEFAULT 0 NOT NULL,
-    paused            boolean            NOT NULL DEFAULT false
+    paused            boolean            NOT NULL DEFAULT false,
+    tags              TEXT[]             NOT NULL DEFAULT '{}',
+    max_concurrent_tasks INTEGER         NOT NULL DEFAULT 0,
+    verification_votes      INTEGER      NOT NULL DEFAULT 0,
+    verification_agreements INTEGER      NOT NULL DEFAULT 0,
+    released_ok_count       INTEGER      NOT NULL DEFAULT 0,
+    released_fail_count     INTEGER      NOT NULL DEFAULT 0
 );
 
 CREATE TABLE project
@@ -29,7 +37,32 @@ CREATE TABLE project
     secret            TEXT               NOT NULL DEFAULT '{}',
     webhook_secret    TEXT               NOT NULL,
     assign_rate       DOUBLE PRECISION   NOT NULL,
-    submit_rate       DOUBLE PRECISION   NOT NULL
+    submit_rate       DOUBLE PRECISION   NOT NULL,
+    retry_delay       INTEGER            NOT NULL DEFAULT 0,
+    retry_multiplier  DOUBLE PRECISION   NOT NULL DEFAULT 1,
+    retry_max_delay   INTEGER            NOT NULL DEFAULT 0,
+    assign_strategy   SMALLINT           NOT NULL DEFAULT 0,
+    max_in_flight_per_group INTEGER      NOT NULL DEFAULT 0,
+    default_max_concurrent_tasks INTEGER NOT NULL DEFAULT 0,
+    dedup_mode        SMALLINT           NOT NULL DEFAULT 0,
+    dedup_ttl         INTEGER            NOT NULL DEFAULT 0,
+    max_verification_attempts INTEGER    NOT NULL DEFAULT 0,
+    min_reputation    DOUBLE PRECISION   NOT NULL DEFAULT 0,
+    trusted_reputation DOUBLE PRECISION  NOT NULL DEFAULT 0,
+    trusted_verification_count SMALLINT  NOT NULL DEFAULT 0,
+    keep_completed_tasks BOOLEAN         NOT NULL DEFAULT FALSE,
+    archive_tasks     BOOLEAN            NOT NULL DEFAULT FALSE,
+    recipe_schema     TEXT               NOT NULL DEFAULT ''
+);
+
+CREATE TABLE project_chain
+(
+    project  INT REFERENCES project (id) ON DELETE CASCADE NOT NULL,
+    target   INT REFERENCES project (id) ON DELETE CASCADE NOT NULL,
+    priority SMALLINT DEFAULT NULL,
+    fields   TEXT[]   DEFAULT NULL,
+    template TEXT     DEFAULT NULL,
+    PRIMARY KEY (project, target)
 );
 
 CREATE TABLE worker_access
@@ -57,13 +90,27 @@ CREATE TABLE task
     retries            SMALLINT DEFAULT 0,
     max_retries        SMALLINT,
     status             SMALLINT DEFAULT 1,
-    recipe             TEXT
+    recipe             TEXT,
+    progress           REAL     DEFAULT 0,
+    checkpoint         TEXT     DEFAULT NULL,
+    not_before         INTEGER  DEFAULT 0,
+    retry_after        INTEGER  DEFAULT 0 NOT NULL,
+    group_key          TEXT     DEFAULT '' NOT NULL,
+    required_tags      TEXT[]   DEFAULT '{}' NOT NULL,
+    -- Set at insert, chain_recipe only parses recipes that are JSON objects
+    recipe_is_object   BOOLEAN  DEFAULT FALSE NOT NULL,
+    -- Only set for COMPLETED tasks, see PurgeCompletedTasks
+    completion_time    INTEGER  DEFAULT NULL
 );
 
 CREATE INDEX priority_desc_index ON task (priority DESC);
 CREATE INDEX assignee_index ON task (assignee);
 CREATE INDEX verifcnt_index ON task (verification_count);
-CREATE UNIQUE INDEX project_hash_unique ON task (project, hash64);
+-- COMPLETED tasks don't prevent submitting the same task again, that is up to the dedup_mode
+CREATE UNIQUE INDEX project_hash_unique ON task (project, hash64) WHERE status != 6;
+CREATE INDEX completion_time_index ON task (completion_time) WHERE status = 6;
+CREATE INDEX project_group_index ON task (project, group_key);
+CREATE INDEX not_before_index ON task (GREATEST(not_before, retry_after)) WHERE assignee IS NULL;
 
 CREATE TABLE worker_verifies_task
 (
@@ -74,6 +121,84 @@ CREATE TABLE worker_verifies_task
 
 CREATE INDEX task_index ON worker_verifies_task (task);
 
+-- One row per group of the tasks of a project, see on_task_group_proc
+CREATE TABLE task_group
+(
+    project     INT REFERENCES project (id) NOT NULL,
+    group_key   TEXT                        NOT NULL,
+    last_assign BIGINT DEFAULT 0            NOT NULL,
+    PRIMARY KEY (project, group_key)
+);
+CREATE INDEX task_group_last_assign_index ON task_group (project, last_assign);
+CREATE SEQUENCE task_group_assign_seq;
+
+CREATE TABLE task_dependency
+(
+    task            INT REFERENCES task (id) ON DELETE CASCADE NOT NULL,
+    parent          INT REFERENCES task (id) ON DELETE CASCADE NOT NULL,
+    cascade_failure BOOLEAN                                    NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (task, parent)
+);
+
+CREATE INDEX task_dependency_parent_index ON task_dependency (parent);
+
+CREATE TABLE task_attempt
+(
+    id        SERIAL PRIMARY KEY,
+    task      INT REFERENCES task (id) ON DELETE CASCADE NOT NULL,
+    worker    INT REFERENCES worker (id)                 NOT NULL,
+    result    SMALLINT                                   NOT NULL,
+    message   TEXT                                       NOT NULL,
+    details   TEXT DEFAULT NULL,
+    timestamp INT                                        NOT NULL
+);
+
+CREATE INDEX task_attempt_task_index ON task_attempt (task);
+
+CREATE TABLE task_result
+(
+    id        SERIAL PRIMARY KEY,
+    project      INT REFERENCES project (id) ON DELETE CASCADE NOT NULL,
+    -- Not a foreign key: results outlive their task, which is deleted once closed
+    task         INT                                          NOT NULL,
+    recipe       TEXT                                         NOT NULL,
+    worker       INT REFERENCES worker (id)                   NOT NULL,
+    verification BIGINT                                       NOT NULL,
+    closed       BOOLEAN                                      NOT NULL,
+    output       TEXT                                         NOT NULL,
+    timestamp    INT                                          NOT NULL
+);
+
+CREATE INDEX task_result_project_index ON task_result (project, id);
+
+CREATE TABLE completed_hash
+(
+    project   INT REFERENCES project (id) ON DELETE CASCADE NOT NULL,
+    hash64    BIGINT                                         NOT NULL,
+    timestamp INT                                            NOT NULL,
+    PRIMARY KEY (project, hash64)
+);
+
+-- Partitions are created (and dropped once past the retention period) by the purge job,
+-- rows outside of them go to the default partition
+CREATE TABLE task_archive
+(
+    id                INT      NOT NULL,
+    project           INT      NOT NULL,
+    hash64            BIGINT   DEFAULT NULL,
+    priority          SMALLINT DEFAULT 0,
+    retries           SMALLINT DEFAULT 0,
+    max_retries       SMALLINT,
+    status            SMALLINT NOT NULL,
+    recipe            TEXT,
+    assignee          INT      DEFAULT NULL,
+    verification_hash BIGINT   DEFAULT NULL,
+    completion_time   INT      NOT NULL
+) PARTITION BY RANGE (completion_time);
+CREATE TABLE task_archive_default PARTITION OF task_archive DEFAULT;
+
+CREATE INDEX task_archive_project_index ON task_archive (project, id);
+
 CREATE TABLE log_entry
 (
     level        INTEGER NOT NULL,
@@ -106,28 +231,110 @@ CREATE TABLE project_monitoring_snapshot
     failed_task_count                INT                         NOT NULL,
     closed_task_count                INT                         NOT NULL,
     awaiting_verification_task_count INT                         NOT NULL,
+    scheduled_task_count             INT                         NOT NULL,
+    retrying_task_count              INT                         NOT NULL,
+    assigned_task_count              INT                         NOT NULL,
+    completed_task_count             INT                         NOT NULL,
+    disputed_task_count              INT                         NOT NULL,
+    cancelled_task_count             INT                         NOT NULL,
     worker_access_count              INT                         NOT NULL,
     timestamp                        INT                         NOT NULL
 );
 
-CREATE OR REPLACE FUNCTION on_task_delete_proc() RETURNS TRIGGER AS
+-- 1: NEW, 2: FAILED, 3: DISPUTED, 4: ASSIGNED, 5: AWAITING_VERIFICATION, 6: COMPLETED, 7: CANCELLED
+CREATE TABLE task_status_transition
+(
+    from_status SMALLINT NOT NULL,
+    to_status   SMALLINT NOT NULL,
+    PRIMARY KEY (from_status, to_status)
+);
+INSERT INTO task_status_transition (from_status, to_status)
+VALUES (1, 4),
+       (1, 2),
+       (1, 7),
+       (4, 1),
+       (4, 2),
+       (4, 3),
+       (4, 5),
+       (4, 6),
+       (4, 7),
+       (5, 4),
+       (5, 2),
+       (5, 7),
+       (2, 1),
+       (2, 5),
+       (2, 7),
+       (3, 1),
+       (3, 7);
+
+-- Recipes that are not JSON objects are copied verbatim
+CREATE OR REPLACE FUNCTION chain_recipe(recipe TEXT, is_object BOOLEAN, fields TEXT[], template TEXT) RETURNS TEXT AS
+$$
+DECLARE
+    res TEXT = recipe;
+    kv  RECORD;
+BEGIN
+    IF NOT is_object THEN
+        RETURN recipe;
+    ELSIF template IS NOT NULL THEN
+        res = template;
+        FOR kv IN SELECT j.key, j.value FROM jsonb_each_text(recipe::jsonb) j
+            LOOP
+                res = replace(res, '{{' || kv.key || '}}', COALESCE(kv.value, ''));
+            END LOOP;
+    ELSIF cardinality(fields) > 0 THEN
+        SELECT COALESCE(jsonb_object_agg(j.key, j.value), '{}'::jsonb)::TEXT
+        INTO res
+        FROM jsonb_each(recipe::jsonb) j
+        WHERE j.key = ANY (fields);
+    end if;
+    RETURN res;
+END;
+$$ LANGUAGE 'plpgsql';
+
+-- Called when a task is completed, either before it is deleted or before it is kept as a tombstone
+CREATE OR REPLACE FUNCTION on_task_completed(t task) RETURNS VOID AS
 $$
 DECLARE
     chain INTEGER;
+BEGIN
+    UPDATE project
+    SET closed_task_count=closed_task_count + 1
+    WHERE id = t.project returning project.chain into chain;
+    UPDATE worker SET closed_task_count=closed_task_count + 1 WHERE id = t.assignee;
+    INSERT INTO completed_hash (project, hash64, timestamp)
+    SELECT t.project, t.hash64, extract(epoch from now() at time zone 'utc')
+    FROM project
+    WHERE id = t.project
+      AND dedup_mode != 0
+      AND t.hash64 IS NOT NULL
+    ON CONFLICT (project, hash64) DO UPDATE SET timestamp=EXCLUDED.timestamp;
+    IF chain != 0 THEN
+        INSERT into task (hash64, project, assignee, max_assign_time, assign_time, verification_count,
+                          priority, retries, max_retries, status, recipe, recipe_is_object)
+        VALUES (t.hash64, chain, NULL, t.max_assign_time, NULL,
+                t.verification_count, t.priority, 0, t.max_retries, 1,
+                t.recipe, t.recipe_is_object)
+        ON CONFLICT DO NOTHING;
+    end if;
+    INSERT into task (hash64, project, assignee, max_assign_time, assign_time, verification_count,
+                      priority, retries, max_retries, status, recipe, recipe_is_object)
+    SELECT t.hash64, pc.target, NULL, t.max_assign_time, NULL,
+           t.verification_count, COALESCE(pc.priority, t.priority), 0, t.max_retries, 1,
+           chain_recipe(t.recipe, t.recipe_is_object, pc.fields, pc.template),
+           -- A rendered template is not known to be a JSON object
+           t.recipe_is_object AND pc.template IS NULL
+    FROM project_chain pc
+    WHERE pc.project = t.project
+    ON CONFLICT DO NOTHING;
+END;
+$$ LANGUAGE 'plpgsql';
+
+CREATE OR REPLACE FUNCTION on_task_delete_proc() RETURNS TRIGGER AS
+$$
 BEGIN
     if OLD.assignee IS NOT NULL THEN
-        UPDATE project
-        SET closed_task_count=closed_task_count + 1
-        WHERE id = OLD.project returning project.chain into chain;
-        UPDATE worker SET closed_task_count=closed_task_count + 1 WHERE id = OLD.assignee;
-        IF chain != 0 THEN
-            INSERT into task (hash64, project, assignee, max_assign_time, assign_time, verification_count,
-                              priority, retries, max_retries, status, recipe)
-            VALUES (old.hash64, chain, NULL, old.max_assign_time, NULL,
-                    old.verification_count, old.priority, 0, old.max_retries, 1,
-                    old.recipe)
-            ON CONFLICT DO NOTHING;
-        end if;
+        PERFORM on_task_completed(OLD);
     end if;
     RETURN OLD;
 END;
@@ -138,6 +345,141 @@ CREATE TRIGGER on_task_delete
     FOR EACH ROW
 EXECUTE PROCEDURE on_task_delete_proc();
 
+-- ASSIGNED is derived from the assignee, and the transition must be
+-- in task_status_transition
+CREATE OR REPLACE FUNCTION on_task_status_proc() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF NEW.assignee IS DISTINCT FROM OLD.assignee OR NEW.status != OLD.status THEN
+        IF NEW.assignee IS NOT NULL AND NEW.status IN (1, 5) THEN
+            NEW.status = 4;
+        ELSIF NEW.assignee IS NULL AND NEW.status IN (1, 4) THEN
+            NEW.status = CASE
+                             WHEN EXISTS(SELECT 1 FROM worker_verifies_task wvt WHERE wvt.task = NEW.id) THEN 5
+                             ELSE 1 END;
+        end if;
+    end if;
+    IF NEW.status != OLD.status AND NOT EXISTS(SELECT 1
+                                               FROM task_status_transition
+                                               WHERE from_status = OLD.status
+                                                 AND to_status = NEW.status) THEN
+        RAISE EXCEPTION 'Invalid task status transition: % -> %', OLD.status, NEW.status;
+    end if;
+    RETURN NEW;
+END;
+$$ LANGUAGE 'plpgsql';
+CREATE TRIGGER on_task_status
+    BEFORE UPDATE
+    ON task
+    FOR EACH ROW
+EXECUTE PROCEDURE on_task_status_proc();
+
+CREATE OR REPLACE FUNCTION on_task_available_proc() RETURNS TRIGGER AS
+$$
+BEGIN
+    -- Tasks that are no longer assigned also free a slot of their group
+    IF TG_OP = 'DELETE' THEN
+        IF OLD.assignee IS NOT NULL THEN
+            PERFORM pg_notify('task_available', OLD.project::TEXT);
+        end if;
+    ELSIF (NEW.assignee IS NULL AND NEW.status IN (1, 5) AND
+           (TG_OP = 'INSERT' OR OLD.assignee IS NOT NULL OR OLD.status NOT IN (1, 5)))
+        OR (TG_OP = 'UPDATE' AND OLD.assignee IS NOT NULL AND NEW.assignee IS NULL) THEN
+        -- Tasks scheduled in the future only move the tracker's wakeup timer
+        IF GREATEST(NEW.not_before, NEW.retry_after) > floor(extract(epoch from now() at time zone 'utc')) THEN
+            PERFORM pg_notify('task_available',
+                              NEW.project::TEXT || ',' || GREATEST(NEW.not_before, NEW.retry_after)::TEXT);
+        ELSE
+            PERFORM pg_notify('task_available', NEW.project::TEXT);
+        end if;
+    end if;
+    RETURN NULL;
+END;
+$$ LANGUAGE 'plpgsql';
+CREATE TRIGGER on_task_available
+    AFTER INSERT OR UPDATE OR DELETE
+    ON task
+    FOR EACH ROW
+EXECUTE PROCEDURE on_task_available_proc();
+
+-- Groups without tasks are deleted by PurgeTaskGroups
+CREATE OR REPLACE FUNCTION on_task_group_proc() RETURNS TRIGGER AS
+$$
+BEGIN
+    INSERT INTO task_group (project, group_key) VALUES (NEW.project, NEW.group_key) ON CONFLICT DO NOTHING;
+    RETURN NULL;
+END;
+$$ LANGUAGE 'plpgsql';
+CREATE TRIGGER on_task_group_insert
+    AFTER INSERT
+    ON task
+    FOR EACH ROW
+EXECUTE PROCEDURE on_task_group_proc();
+CREATE TRIGGER on_task_group_move
+    AFTER UPDATE OF project
+    ON task
+    FOR EACH ROW
+    WHEN (OLD.project != NEW.project)
+EXECUTE PROCEDURE on_task_group_proc();
+
+-- Children that don't cascade the failure no longer wait for the parent
+CREATE OR REPLACE FUNCTION on_task_failed_proc() RETURNS TRIGGER AS
+$$
+BEGIN
+    UPDATE task
+    SET status=2,
+        assignee=NULL,
+        assign_time=NULL
+    WHERE status IN (1, 4, 5)
+      AND id IN (SELECT td.task FROM task_dependency td WHERE td.parent = NEW.id AND td.cascade_failure);
+    -- FAILED parents can be reset, their children keep waiting until they are completed or cancelled
+    IF NEW.status = 7 THEN
+        DELETE FROM task_dependency WHERE parent = NEW.id;
+    end if;
+    RETURN NULL;
+END;
+$$ LANGUAGE 'plpgsql';
+CREATE TRIGGER on_task_failed
+    AFTER UPDATE
+    ON task
+    FOR EACH ROW
+    WHEN (NEW.status IN (2, 7) AND OLD.status != NEW.status)
+EXECUTE PROCEDURE on_task_failed_proc();
+
+CREATE OR REPLACE FUNCTION on_task_dependency_delete_proc() RETURNS TRIGGER AS
+$$
+DECLARE
+    pid INTEGER;
+BEGIN
+    -- Completed parents delete their dependencies before they are deleted, the
+    -- children of parents that are deleted in any other way are cancelled
+    IF NOT EXISTS(SELECT 1 FROM task WHERE id = OLD.parent) THEN
+        UPDATE task
+        SET status=7,
+            assignee=NULL,
+            assign_time=NULL
+        WHERE id = OLD.task
+          AND status IN (1, 2, 4, 5);
+        RETURN NULL;
+    end if;
+
+    SELECT project
+    INTO pid
+    FROM task
+    WHERE id = OLD.task
+      AND NOT EXISTS(SELECT 1 FROM task_dependency td WHERE td.task = OLD.task);
+    IF pid IS NOT NULL THEN
+        PERFORM pg_notify('task_available', pid::TEXT);
+    end if;
+    RETURN NULL;
+END;
+$$ LANGUAGE 'plpgsql';
+CREATE TRIGGER on_task_dependency_delete
+    AFTER DELETE
+    ON task_dependency
+    FOR EACH ROW
+EXECUTE PROCEDURE on_task_dependency_delete_proc();
+
 CREATE OR REPLACE FUNCTION on_manager_insert() RETURNS TRIGGER AS
 $$
 BEGIN
@@ -153,36 +495,134 @@ CREATE TRIGGER on_manager_insert
     FOR EACH ROW
 EXECUTE PROCEDURE on_manager_insert();
 
+-- Between 0 and 1, the mean of the (smoothed) verification agreement rate and TR_OK rate.
+-- Workers without history start at 0.5
+CREATE OR REPLACE FUNCTION worker_reputation(votes INT, agreements INT, ok INT, fail INT)
+    RETURNS DOUBLE PRECISION AS
+$$
+SELECT ((agreements + 1)::DOUBLE PRECISION / (votes + 2) + (ok + 1)::DOUBLE PRECISION / (ok + fail + 2)) / 2;
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- Verification agreement rate, compared to trusted_reputation. Only counts once the
+-- worker voted on 10 tasks that reached a consensus, the TR_OK rate is self-reported
+CREATE OR REPLACE FUNCTION worker_trust(votes INT, agreements INT)
+    RETURNS DOUBLE PRECISION AS
+$$
+SELECT CASE WHEN votes < 10 THEN 0 ELSE agreements::DOUBLE PRECISION / votes END;
+$$ LANGUAGE SQL IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION on_task_attempt_insert_proc() RETURNS TRIGGER AS
+$$
+BEGIN
+    UPDATE worker
+    SET released_ok_count=released_ok_count + (NEW.result = 0)::INT,
+        released_fail_count=released_fail_count + (NEW.result = 1)::INT
+    WHERE id = NEW.worker;
+    RETURN NULL;
+END;
+$$ LANGUAGE 'plpgsql';
+CREATE TRIGGER on_task_attempt_insert
+    AFTER INSERT
+    ON task_attempt
+    FOR EACH ROW
+EXECUTE PROCEDURE on_task_attempt_insert_proc();
+
 CREATE OR REPLACE FUNCTION release_task_ok(wid INT, tid INT, ver BIGINT) RETURNS BOOLEAN AS
 $$
 DECLARE
-    res INT = NULL;
+    closes    BOOLEAN = FALSE;
+    keep      BOOLEAN = FALSE;
+    archive   BOOLEAN = FALSE;
+    completed task;
+    vcount    INT     = NULL;
+    top_hash  BIGINT  = NULL;
+    top_count INT     = 0;
+    votes     INT     = 0;
+    required  INT     = NULL;
 BEGIN
-    DELETE FROM task WHERE id = tid AND assignee = wid AND verification_count = 1 RETURNING project INTO res;
+    -- Trusted workers need fewer matching verifications to close a task
+    SELECT task.verification_count,
+           CASE
+               WHEN project.trusted_verification_count > 0 AND project.trusted_reputation > 0
+                   AND worker_trust(worker.verification_votes, worker.verification_agreements)
+                        >= project.trusted_reputation
+                   THEN LEAST(task.verification_count, project.trusted_verification_count)
+               ELSE task.verification_count END,
+           project.keep_completed_tasks,
+           project.archive_tasks
+    INTO vcount, required, keep, archive
+    FROM task
+             INNER JOIN project ON project.id = task.project
+             INNER JOIN worker ON worker.id = wid
+    WHERE task.id = tid
+      AND task.assignee = wid;
 
-    IF res IS NULL THEN
-        INSERT INTO worker_verifies_task (worker, verification_hash, task)
-        SELECT wid, ver, task.id
-        FROM task
-        WHERE assignee = wid
-          AND task.id = tid;
+    IF vcount IS NULL THEN
+        RETURN FALSE;
+    end if;
 
-        DELETE
-        FROM task
-        WHERE id = tid
-          AND assignee = wid
-          AND (SELECT COUNT(*) as vcnt
-               FROM worker_verifies_task wvt
-               WHERE task = tid
-               GROUP BY wvt.verification_hash
-               ORDER BY vcnt DESC
-               LIMIT 1) >= task.verification_count RETURNING task.id INTO res;
-
-        IF res IS NULL THEN
-            UPDATE task SET assignee=NULL WHERE id = tid AND assignee = wid;
+    IF vcount = 1 THEN
+        closes = TRUE;
+        top_hash = ver;
+    ELSE
+        INSERT INTO worker_verifies_task (worker, verification_hash, task) VALUES (wid, ver, tid);
+
+        SELECT wvt.verification_hash, COUNT(*) as vcnt
+        INTO top_hash, top_count
+        FROM worker_verifies_task wvt
+        WHERE task = tid
+        GROUP BY wvt.verification_hash
+        ORDER BY vcnt DESC, (wvt.verification_hash = ver) DESC
+        LIMIT 1;
+
+        SELECT COUNT(*) INTO votes FROM worker_verifies_task WHERE task = tid;
+
+        IF top_count >= required THEN
+            closes = TRUE;
+
+            -- Votes are deleted along with the task, count the agreements first
+            UPDATE worker
+            SET verification_votes=verification_votes + 1,
+                verification_agreements=verification_agreements + (wvt.verification_hash = top_hash)::INT
+            FROM worker_verifies_task wvt
+            WHERE wvt.task = tid
+              AND wvt.worker = worker.id;
+        ELSE
+            UPDATE task
+            SET assignee=NULL,
+                status=CASE
+                           WHEN project.max_verification_attempts > 0
+                               AND votes >= project.max_verification_attempts THEN 3
+                           ELSE task.status END
+            FROM project
+            WHERE task.id = tid
+              AND project.id = task.project;
         end if;
     end if;
 
-    RETURN res IS NOT NULL;
+    IF closes AND archive THEN
+        INSERT INTO task_archive (id, project, hash64, priority, retries, max_retries, status, recipe,
+                                  assignee, verification_hash, completion_time)
+        SELECT id, project, hash64, priority, retries, max_retries, 6, recipe,
+               wid, top_hash, extract(epoch from now() at time zone 'utc')
+        FROM task
+        WHERE id = tid;
+        DELETE FROM task_dependency WHERE parent = tid;
+        DELETE FROM task WHERE id = tid;
+    ELSIF closes AND keep THEN
+        SELECT * INTO completed FROM task WHERE id = tid;
+        PERFORM on_task_completed(completed);
+        UPDATE task
+        SET status=6,
+            assignee=NULL,
+            completion_time=extract(epoch from now() at time zone 'utc')
+        WHERE id = tid;
+        DELETE FROM task_dependency WHERE parent = tid;
+    ELSIF closes THEN
+        DELETE FROM task_dependency WHERE parent = tid;
+        DELETE FROM task WHERE id = tid;
+    end if;
+
+    RETURN closes;
 END;
 $$ LANGUAGE 'plpgsql';
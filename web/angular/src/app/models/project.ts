@@ -12,4 +12,5 @@ export interface Project {
     paused: boolean;
     assign_rate: number;
     submit_rate: number;
+    recipe_schema: string;
 }